@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// predictions are the batch sizes and contention ratios the analysis predicts the throughput at, as batch:contention
+var predictions = [][2]float64{}
+
+// modelKey is a strategy as measured under a transaction mode, schema and cache mode, which each get a model
+type modelKey struct {
+	name      string
+	txnMode   string
+	schema    string
+	cacheMode string
+}
+
+// observation is a measured throughput at a batch size and contention ratio
+type observation struct {
+	batchSize       float64
+	contentionRatio float64
+	throughput      float64
+}
+
+// throughputModel explains the time spent per object by a fixed cost per transaction spread over the batch, a cost per
+// row growing with the contention ratio, and a penalty per row growing with the batch size for the locks and memory a
+// larger transaction holds:
+//
+//	1 / throughput = perTransaction / batch size + perRow + perRowContention * contention ratio + perRowBatch * batch size
+//
+// The costs are in seconds.
+type throughputModel struct {
+	perTransaction   float64
+	perRow           float64
+	perRowContention float64
+	perRowBatch      float64
+	rSquared         float64
+	observations     int
+}
+
+func (m throughputModel) predict(batchSize, contentionRatio float64) float64 {
+	return 1 / (m.perTransaction/batchSize + m.perRow + m.perRowContention*contentionRatio + m.perRowBatch*batchSize)
+}
+
+// optimalBatchSize is the batch size balancing the transaction cost against the batch penalty, 0 when the model has no
+// such balance and larger batches are always better or always worse
+func (m throughputModel) optimalBatchSize() float64 {
+	if m.perTransaction <= 0 || m.perRowBatch <= 0 {
+		return 0
+	}
+	return math.Sqrt(m.perTransaction / m.perRowBatch)
+}
+
+// readResults reads the measurements of the strategies from a results file. The setup steps, the background load and
+// the adaptive runs, whose batch size is not the one of the cell, are left out.
+func readResults(path string) (map[modelKey][]observation, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open results: %w", err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read results: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no results in '%s'", path)
+	}
+
+	// Older results lack some of the columns, which are then left empty
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	results := make(map[modelKey][]observation)
+	for _, record := range records[1:] {
+		name := field(record, "Name")
+		if !isStrategy(name) || strings.HasSuffix(name, " (adaptive)") {
+			continue
+		}
+		batchSize, err := strconv.ParseFloat(field(record, "Batch Size"), 64)
+		if err != nil || batchSize <= 0 {
+			continue
+		}
+		contentionRatio, err := strconv.ParseFloat(field(record, "Contention Ratio"), 64)
+		if err != nil {
+			continue
+		}
+		throughput, err := strconv.ParseFloat(field(record, "Effective Throughput"), 64)
+		if err != nil || throughput <= 0 {
+			continue
+		}
+		key := modelKey{name: name, txnMode: field(record, "Txn Mode"), schema: field(record, "Schema"), cacheMode: field(record, "Cache")}
+		results[key] = append(results[key], observation{batchSize: batchSize, contentionRatio: contentionRatio, throughput: throughput})
+	}
+	return results, nil
+}
+
+// fitThroughputModel fits the model to the observations by least squares on the time per object
+func fitThroughputModel(observations []observation) (throughputModel, error) {
+	features := func(o observation) []float64 {
+		return []float64{1 / o.batchSize, 1, o.contentionRatio, o.batchSize}
+	}
+	const n = 4
+	// Normal equations: (XᵀX) β = Xᵀy
+	a := make([][]float64, n)
+	for i := range a {
+		a[i] = make([]float64, n+1)
+	}
+	for _, o := range observations {
+		x, y := features(o), 1/o.throughput
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				a[i][j] += x[i] * x[j]
+			}
+			a[i][n] += x[i] * y
+		}
+	}
+	// Gaussian elimination with partial pivoting
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return throughputModel{}, fmt.Errorf("too few distinct batch sizes and contention ratios to fit")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for row := 0; row < n; row++ {
+			if row == col {
+				continue
+			}
+			factor := a[row][col] / a[col][col]
+			for k := col; k <= n; k++ {
+				a[row][k] -= factor * a[col][k]
+			}
+		}
+	}
+	model := throughputModel{
+		perTransaction:   a[0][n] / a[0][0],
+		perRow:           a[1][n] / a[1][1],
+		perRowContention: a[2][n] / a[2][2],
+		perRowBatch:      a[3][n] / a[3][3],
+		observations:     len(observations),
+	}
+
+	mean := 0.0
+	for _, o := range observations {
+		mean += 1 / o.throughput
+	}
+	mean /= float64(len(observations))
+	residual, total := 0.0, 0.0
+	for _, o := range observations {
+		y := 1 / o.throughput
+		residual += math.Pow(y-1/model.predict(o.batchSize, o.contentionRatio), 2)
+		total += math.Pow(y-mean, 2)
+	}
+	model.rSquared = 1 - residual/total
+	return model, nil
+}
+
+// RunAnalysis fits a throughput model per strategy to the results and reports the costs, the goodness of fit, the
+// predicted optimal batch size and the throughput predicted at the requested settings
+func RunAnalysis(log *log.Logger, path string) error {
+	results, err := readResults(path)
+	if err != nil {
+		return err
+	}
+	env, err := readEnvironment(path)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Printf("%s: %s", name, env[name])
+	}
+	keys := make([]modelKey, 0, len(results))
+	for key := range results {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	for _, key := range keys {
+		label := fmt.Sprintf("%s:\t txn mode %s\t schema %s\t cache %s", key.name, key.txnMode, key.schema, key.cacheMode)
+		model, err := fitThroughputModel(results[key])
+		if err != nil {
+			log.Printf("%s\t not fitted: %v", label, err)
+			continue
+		}
+		log.Printf("%s\t per transaction %.3fms\t per row %.3fms\t per row and contention %.3fms\t per row and batch row %.6fms\t R² %.3f\t observations %d",
+			label, model.perTransaction*1000, model.perRow*1000, model.perRowContention*1000, model.perRowBatch*1000, model.rSquared, model.observations,
+		)
+		if optimal := model.optimalBatchSize(); optimal > 0 {
+			log.Printf("%s\t predicted optimal batch size %.0f\t predicted throughput %.2f at contention 0\t %.2f at contention 1",
+				label, optimal, model.predict(optimal, 0), model.predict(optimal, 1),
+			)
+		} else {
+			log.Printf("%s\t no predicted optimal batch size", label)
+		}
+		for _, prediction := range predictions {
+			log.Printf("%s\t batch size %.0f\t contention ratio %.2f\t predicted throughput %.2f", label, prediction[0], prediction[1], model.predict(prediction[0], prediction[1]))
+		}
+	}
+	return nil
+}
+
+func parsePrediction(value string) ([2]float64, error) {
+	batch, contention, ok := strings.Cut(value, ":")
+	if !ok {
+		return [2]float64{}, fmt.Errorf("invalid prediction '%s': expected batch:contention", value)
+	}
+	batchSize, err := strconv.ParseFloat(batch, 64)
+	if err != nil || batchSize <= 0 {
+		return [2]float64{}, fmt.Errorf("invalid batch size '%s'", batch)
+	}
+	contentionRatio, err := strconv.ParseFloat(contention, 64)
+	if err != nil {
+		return [2]float64{}, fmt.Errorf("invalid contention ratio '%s'", contention)
+	}
+	return [2]float64{batchSize, contentionRatio}, nil
+}
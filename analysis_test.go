@@ -0,0 +1,143 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// observe samples the throughput of the model at every batch size and contention ratio
+func observe(model throughputModel, batchSizes, contentionRatios []float64) []observation {
+	observations := make([]observation, 0, len(batchSizes)*len(contentionRatios))
+	for _, batchSize := range batchSizes {
+		for _, contentionRatio := range contentionRatios {
+			observations = append(observations, observation{batchSize: batchSize, contentionRatio: contentionRatio, throughput: model.predict(batchSize, contentionRatio)})
+		}
+	}
+	return observations
+}
+
+func TestFitThroughputModel(t *testing.T) {
+	batchSizes := []float64{1, 10, 100, 1000, 10000}
+	contentionRatios := []float64{0, 0.25, 0.5, 1}
+	for _, test := range []struct {
+		name  string
+		model throughputModel
+	}{
+		{"transaction bound", throughputModel{perTransaction: 5e-3, perRow: 1e-5}},
+		{"contended", throughputModel{perTransaction: 2e-3, perRow: 2e-5, perRowContention: 8e-5}},
+		{"batch penalty", throughputModel{perTransaction: 1e-3, perRow: 1e-5, perRowContention: 3e-5, perRowBatch: 1e-8}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			model, err := fitThroughputModel(observe(test.model, batchSizes, contentionRatios))
+			if err != nil {
+				t.Fatalf("fitThroughputModel: %v", err)
+			}
+			for _, cost := range []struct {
+				name          string
+				got, expected float64
+			}{
+				{"per transaction", model.perTransaction, test.model.perTransaction},
+				{"per row", model.perRow, test.model.perRow},
+				{"per row and contention", model.perRowContention, test.model.perRowContention},
+				{"per row and batch row", model.perRowBatch, test.model.perRowBatch},
+			} {
+				if math.Abs(cost.got-cost.expected) > 1e-9+1e-6*math.Abs(cost.expected) {
+					t.Errorf("%s: got %g, expected %g", cost.name, cost.got, cost.expected)
+				}
+			}
+			if model.rSquared < 0.999999 {
+				t.Errorf("R²: got %g, expected 1", model.rSquared)
+			}
+			if model.observations != len(batchSizes)*len(contentionRatios) {
+				t.Errorf("observations: got %d, expected %d", model.observations, len(batchSizes)*len(contentionRatios))
+			}
+		})
+	}
+}
+
+func TestFitThroughputModelUnderdetermined(t *testing.T) {
+	// A single batch size cannot tell the transaction cost from the row cost
+	model := throughputModel{perTransaction: 1e-3, perRow: 1e-5}
+	if _, err := fitThroughputModel(observe(model, []float64{100}, []float64{0, 0.5, 1})); err == nil {
+		t.Error("fitThroughputModel: expected an error")
+	}
+}
+
+func TestOptimalBatchSize(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		model    throughputModel
+		expected float64
+	}{
+		{"balanced", throughputModel{perTransaction: 1e-2, perRowBatch: 1e-8}, 1000},
+		{"no batch penalty", throughputModel{perTransaction: 1e-2}, 0},
+		{"no transaction cost", throughputModel{perRowBatch: 1e-8}, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.model.optimalBatchSize(); math.Abs(got-test.expected) > 1e-6 {
+				t.Errorf("got %g, expected %g", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestReadResults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	// Rows as the sweep writes them: the strategies are named without their transaction mode, which has a column of its
+	// own, next to the setup steps and the load running alongside them
+	results := `Name,Batch Size,Contention Ratio,Txn Mode,Schema,Cache,Position,Total Time,Effective Throughput,Retries,Deadlocks,Outlier,Traced
+txn batch merge,100,0.50,managed,unique+rel,warm,2,1000,2000.00,0,0,false,false
+txn batch merge,100,0.50,explicit,unique+rel,warm,3,1250,1600.00,0,0,false,false
+txn batch merge (adaptive),100,0.50,managed,unique+rel,warm,14,900,2200.00,0,0,false,false
+batch create,100,0.50,managed,unique+rel,warm,2,100,5000.00,0,0,false,false
+populate user nodes,100,0.50,managed,unique+rel,warm,0,100,5000.00,0,0,false,false
+background read point lookup,100,0.50,managed,unique+rel,warm,5,100,700.00,0,0,false,false
+concurrent update user nodes,100,0.50,managed,unique+rel,warm,6,100,600.00,0,0,false,false
+`
+	if err := os.WriteFile(path, []byte(results), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	read, err := readResults(path)
+	if err != nil {
+		t.Fatalf("readResults: %v", err)
+	}
+	if len(read) != 2 {
+		t.Fatalf("got %v, expected the strategy in both transaction modes only", read)
+	}
+	for _, test := range []struct {
+		txnMode    string
+		throughput float64
+	}{
+		{"managed", 2000},
+		{"explicit", 1600},
+	} {
+		key := modelKey{name: "txn batch merge", txnMode: test.txnMode, schema: "unique+rel", cacheMode: "warm"}
+		if len(read[key]) != 1 {
+			t.Fatalf("%s: got %v, expected a single observation", test.txnMode, read[key])
+		}
+		if o := read[key][0]; o.batchSize != 100 || o.contentionRatio != 0.5 || o.throughput != test.throughput {
+			t.Errorf("%s: got %+v", test.txnMode, o)
+		}
+	}
+}
+
+func TestEnvironmentSidecar(t *testing.T) {
+	defer func(env [][2]string) { environment = env }(environment)
+	path := filepath.Join(t.TempDir(), "results.csv")
+	if env, err := readEnvironment(path); err != nil || env != nil {
+		t.Fatalf("readEnvironment without a sidecar: got %v, %v", env, err)
+	}
+	environment = [][2]string{{"host", "bench-1"}, {"cpus", "16"}}
+	if err := writeEnvironment(path); err != nil {
+		t.Fatalf("writeEnvironment: %v", err)
+	}
+	env, err := readEnvironment(path)
+	if err != nil {
+		t.Fatalf("readEnvironment: %v", err)
+	}
+	if len(env) != 2 || env["host"] != "bench-1" || env["cpus"] != "16" {
+		t.Errorf("got %v", env)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	// adaptiveBatching adds an adaptive run of every txn batch node experiment, next to the fixed batch size ones
+	adaptiveBatching      = false
+	adaptiveTargetLatency = 100 * time.Millisecond
+	adaptiveIncrease      = 100
+	adaptiveDecrease      = 0.5
+	adaptiveMaxBatch      = 10000
+)
+
+// validateAdaptiveBatching rejects the settings under which an adaptive batch size would stop growing, stop shrinking
+// or end up empty
+func validateAdaptiveBatching() error {
+	if adaptiveIncrease < 1 {
+		return fmt.Errorf("invalid adaptive increase %d: expected at least 1", adaptiveIncrease)
+	}
+	if adaptiveMaxBatch < 1 {
+		return fmt.Errorf("invalid adaptive max batch %d: expected at least 1", adaptiveMaxBatch)
+	}
+	if adaptiveDecrease <= 0 || adaptiveDecrease >= 1 {
+		return fmt.Errorf("invalid adaptive decrease %g: expected between 0 and 1", adaptiveDecrease)
+	}
+	return nil
+}
+
+// batchSizer hands out the size of the next batch of a txn batch executor. A fixed sizer always hands out the batch
+// size; an adaptive one starts from it, adds adaptiveIncrease after every transaction faster than the target latency
+// and multiplies by adaptiveDecrease after a slower one or one that had to be retried.
+type batchSizer struct {
+	adaptive bool
+	current  int
+}
+
+func newBatchSizer(batchSize int, adaptive bool) *batchSizer {
+	return &batchSizer{adaptive: adaptive, current: batchSize}
+}
+
+// label names the measurements of an adaptive executor apart from those of the fixed batch size it started from
+func (s *batchSizer) label(name string) string {
+	if !s.adaptive {
+		return name
+	}
+	return name + " (adaptive)"
+}
+
+func (s *batchSizer) size() int {
+	return s.current
+}
+
+// observe adjusts the batch size after a transaction took elapsed, retried when transient errors made it start over
+func (s *batchSizer) observe(elapsed time.Duration, retried bool) {
+	if !s.adaptive {
+		return
+	}
+	if retried || elapsed > adaptiveTargetLatency {
+		s.current = max(int(float64(s.current)*adaptiveDecrease), 1)
+	} else {
+		s.current = min(s.current+adaptiveIncrease, adaptiveMaxBatch)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// databaseName is the database the sessions run against, empty for the server default. It only changes between
+// experiments, when an experiment family gets a database of its own or a throwaway database replaces the previous one.
+// The background work runs its queries under the read lock, so that once the database is swapped or replaced under the
+// write lock no background query is left running against the old one.
+var databaseMu sync.RWMutex
+var databaseName = ""
+
+func currentDatabase() string {
+	databaseMu.RLock()
+	defer databaseMu.RUnlock()
+	return databaseName
+}
+
+func setDatabase(name string) {
+	databaseMu.Lock()
+	defer databaseMu.Unlock()
+	databaseName = name
+}
+
+// withDatabase runs a background query against the current database, holding off any swap of the database until it
+// is done. The query must not look up the database itself.
+func withDatabase(query func(database string) error) error {
+	databaseMu.RLock()
+	defer databaseMu.RUnlock()
+	return query(databaseName)
+}
+
+// replacingDatabase holds off the background queries while the current database is replaced in place
+func replacingDatabase(replace func() error) error {
+	databaseMu.Lock()
+	defer databaseMu.Unlock()
+	return replace()
+}
+
+// isolateDatabases gives every experiment family a database of its own, so that several sweeps can share a server
+var isolateDatabases = false
+
+// executeSystemQuery runs an administration command against the system database
+func executeSystemQuery(driver neo4j.DriverWithContext, query string, params map[string]any) error {
+	if _, err := neo4j.ExecuteQuery(context.Background(), driver, query, params, neo4j.EagerResultTransformer, neo4j.ExecuteQueryWithDatabase("system")); err != nil {
+		return fmt.Errorf("failed to execute query '%s': %w", query, err)
+	}
+	return nil
+}
+
+// runIsolated runs the experiment family in a database created for it and dropped afterwards, whether the run
+// succeeded or not. The process id keeps the database apart from those of sweeps running side by side.
+func runIsolated(logger *log.Logger, driver neo4j.DriverWithContext, family string, run func(*log.Logger, neo4j.DriverWithContext) error) (err error) {
+	name := fmt.Sprintf("glatency-%s-%d", family, os.Getpid())
+	if err := executeSystemQuery(driver, "CREATE DATABASE $name IF NOT EXISTS WAIT", map[string]any{"name": name}); err != nil {
+		return err
+	}
+	previous := currentDatabase()
+	setDatabase(name)
+	defer setDatabase(previous)
+	defer func() {
+		// A throwaway reset may have moved the family on to another database
+		err = errors.Join(err, restoreDatabase(driver, name))
+		err = errors.Join(err, executeSystemQuery(driver, "DROP DATABASE $name IF EXISTS", map[string]any{"name": name}))
+	}()
+	if err := applySchema(driver, defaultSchema); err != nil {
+		return err
+	}
+	return run(logger, driver)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func RunDeleteExperiments(log *log.Logger, driver neo4j.DriverWithContext) error {
+	log.Print("running experiments")
+	for _, batchSize := range batches {
+		log.Printf("batch size: %d", batchSize)
+		for _, contentionRatio := range contentionRatios {
+			log.Printf("contention ratio: %.2f", contentionRatio)
+			err := forEachRun(log, driver, batchSize, contentionRatio, func() error {
+				// Create test sets
+
+				// Only the pre-created fraction of the deleted nodes actually exists
+				preCreatedObjects := int(contentionRatio * totalObjects)
+
+				random := generateUniqueRandomNumbers(0, totalObjects, preCreatedObjects)
+				queriesCreatePartial := make([]ParamedCql, 0)
+				for _, i := range random {
+					queriesCreatePartial = append(queriesCreatePartial, ParamedCql{
+						Query:  "CREATE (n:User{" + keyPattern("_id", "tenantId") + "}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+						Params: getUserParams(i),
+					})
+				}
+				queriesDelete := make([]ParamedCql, 0)
+				queriesSoftDelete := make([]ParamedCql, 0)
+				for i := 0; i < totalObjects; i++ {
+					queriesDelete = append(queriesDelete, ParamedCql{
+						Query:  "MATCH (n:User{" + keyPattern("_id", "tenantId") + "}) DETACH DELETE n",
+						Entity: "User",
+						Params: getUserParams(i),
+					})
+					params := getUserParams(i)
+					params["deletedAt"] = time.Now().Unix()
+					queriesSoftDelete = append(queriesSoftDelete, ParamedCql{
+						Query:  "MATCH (n:User{" + keyPattern("_id", "tenantId") + "}) WHERE n.deletedAt IS NULL SET n += {deletedAt: $deletedAt, updatedAt: $updatedAt}",
+						Entity: "User",
+						Params: params,
+					})
+				}
+
+				// Edges live on the configured graph shape, of which only the pre-created fraction of edges (or, for
+				// reconciliation, of endpoints) exists up front
+				users, groups, edges := generateGraph()
+				queriesCreateUserNodes := make([]ParamedCql, 0)
+				queriesMergeUserNodes := make([]ParamedCql, 0)
+				for i := 0; i < users; i++ {
+					queriesCreateUserNodes = append(queriesCreateUserNodes, ParamedCql{
+						Query:  "CREATE (n:User{" + keyPattern("_id", "tenantId") + "}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+						Params: getUserParams(i),
+					})
+					queriesMergeUserNodes = append(queriesMergeUserNodes, ParamedCql{
+						Query:  "MERGE (n:User{" + keyPattern("_id", "tenantId") + "}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+						Entity: "User",
+						Params: getUserParams(i),
+					})
+				}
+				queriesCreateGroupNodes := make([]ParamedCql, 0)
+				queriesMergeGroupNodes := make([]ParamedCql, 0)
+				for i := 0; i < groups; i++ {
+					queriesCreateGroupNodes = append(queriesCreateGroupNodes, ParamedCql{
+						Query:  "CREATE (n:Group{" + keyPattern("_id", "tenantId") + "}) SET n += {id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+						Params: getGroupParams(i),
+					})
+					queriesMergeGroupNodes = append(queriesMergeGroupNodes, ParamedCql{
+						Query:  "MERGE (n:Group{" + keyPattern("_id", "tenantId") + "}) SET n += {id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+						Entity: "Group",
+						Params: getGroupParams(i),
+					})
+				}
+
+				randomEdges := generateUniqueRandomNumbers(0, len(edges), int(float64(len(edges))*contentionRatio))
+				queriesCreateEdgesPartial := make([]ParamedCql, 0)
+				for _, e := range randomEdges {
+					queriesCreateEdgesPartial = append(queriesCreateEdgesPartial, ParamedCql{
+						Query:  "MATCH (u:User{" + keyPattern("user_id", "user_tenant") + "}), (g:Group{" + keyPattern("group_id", "group_tenant") + "}) CREATE (g)-[r:GROUP_USER_BINDING{`~id`: $_id}]->(u)",
+						Params: getEdgeParams(edges[e][0], edges[e][1]),
+					})
+				}
+				queriesDeleteEdges := make([]ParamedCql, 0)
+				queriesSoftDeleteEdges := make([]ParamedCql, 0)
+				queriesCreateShellEdges := make([]ParamedCql, 0)
+				for _, edge := range edges {
+					queriesDeleteEdges = append(queriesDeleteEdges, ParamedCql{
+						Query:  "MATCH (g:Group{" + keyPattern("group_id", "group_tenant") + "})-[r:GROUP_USER_BINDING{`~id`: $_id}]->(u:User{" + keyPattern("user_id", "user_tenant") + "}) DELETE r",
+						Params: getEdgeParams(edge[0], edge[1]),
+					})
+					params := getEdgeParams(edge[0], edge[1])
+					params["deletedAt"] = time.Now().Unix()
+					queriesSoftDeleteEdges = append(queriesSoftDeleteEdges, ParamedCql{
+						Query:  "MATCH (g:Group{" + keyPattern("group_id", "group_tenant") + "})-[r:GROUP_USER_BINDING{`~id`: $_id}]->(u:User{" + keyPattern("user_id", "user_tenant") + "}) WHERE r.deletedAt IS NULL SET r.deletedAt = $deletedAt",
+						Params: params,
+					})
+					queriesCreateShellEdges = append(queriesCreateShellEdges, ParamedCql{
+						Query:  "MERGE (u:User{" + keyPattern("user_id", "user_tenant") + "}) ON CREATE SET u += {tenantId: $user_tenant, isShellEntity: true, deletedAt: null} MERGE (g:Group{" + keyPattern("group_id", "group_tenant") + "}) ON CREATE SET g += {tenantId: $group_tenant, isShellEntity: true, deletedAt: null} CREATE (g)-[r:GROUP_USER_BINDING{`~id`: $_id}]->(u)",
+						Params: getEdgeParams(edge[0], edge[1]),
+					})
+				}
+				queriesCreateUserNodesPartial := make([]ParamedCql, 0)
+				for _, i := range generateUniqueRandomNumbers(0, users, int(float64(users)*contentionRatio)) {
+					queriesCreateUserNodesPartial = append(queriesCreateUserNodesPartial, queriesCreateUserNodes[i])
+				}
+				queriesCreateGroupNodesPartial := make([]ParamedCql, 0)
+				for _, i := range generateUniqueRandomNumbers(0, groups, int(float64(groups)*contentionRatio)) {
+					queriesCreateGroupNodesPartial = append(queriesCreateGroupNodesPartial, queriesCreateGroupNodes[i])
+				}
+
+				if err := ExperimentBatchedDelete(driver, queriesCreatePartial, queriesDelete, batchSize, contentionRatio); err != nil {
+					return err
+				}
+				if err := ExperimentBatchedDeleteInTxnBatches(driver, queriesCreatePartial, queriesDelete, batchSize, contentionRatio); err != nil {
+					return err
+				}
+				if err := ExperimentBatchedSoftDelete(driver, queriesCreatePartial, queriesSoftDelete, batchSize, contentionRatio); err != nil {
+					return err
+				}
+				if err := ExperimentBatchedSoftDeleteInTxnBatches(driver, queriesCreatePartial, queriesSoftDelete, batchSize, contentionRatio); err != nil {
+					return err
+				}
+				if err := ExperimentBatchedEdgeDeleteInTxnBatches(driver, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, queriesDeleteEdges, batchSize, contentionRatio); err != nil {
+					return err
+				}
+				if err := ExperimentBatchedEdgeSoftDeleteInTxnBatches(driver, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, queriesSoftDeleteEdges, batchSize, contentionRatio); err != nil {
+					return err
+				}
+				return ExperimentShellEntityReconciliationInTxnBatches(driver, queriesCreateUserNodesPartial, queriesCreateGroupNodesPartial, queriesCreateShellEdges, queriesMergeUserNodes, queriesMergeGroupNodes, batchSize, contentionRatio)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func ExperimentBatchedDelete(driver neo4j.DriverWithContext, queriesCreatePartial, queriesDelete []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Experiment D1: Hard delete nodes using batched DETACH DELETE queries
+	// Partially populate the graph in batches
+	if err := executeBlindCreateTxn(driver, "batch create", queriesCreatePartial, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute create queries: %w", err)
+	}
+	// Execute the delete queries in batches
+	if err := executeDeleteTxn(driver, "batch delete", queriesDelete, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute delete queries: %w", err)
+	}
+	// Clear the graph
+	if err := resetGraph(driver); err != nil {
+		return fmt.Errorf("failed to clean up graph: %w", err)
+	}
+	return nil
+}
+
+func ExperimentBatchedDeleteInTxnBatches(driver neo4j.DriverWithContext, queriesCreatePartial, queriesDelete []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Experiment D2: Hard delete nodes using txn batched DETACH DELETE queries
+	// Partially populate the graph in batches
+	if err := executeBlindCreateInTxnBatches(driver, "txn batch create", queriesCreatePartial, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute create queries: %w", err)
+	}
+	// Execute the delete queries in batches
+	if err := executeDeleteInTxnBatches(driver, "txn batch delete", queriesDelete, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute delete queries: %w", err)
+	}
+	// Clear the graph
+	if err := resetGraph(driver); err != nil {
+		return fmt.Errorf("failed to clean up graph: %w", err)
+	}
+	return nil
+}
+
+func ExperimentBatchedSoftDelete(driver neo4j.DriverWithContext, queriesCreatePartial, queriesSoftDelete []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Experiment D3: Soft delete nodes using batched SET deletedAt queries
+	// Partially populate the graph in batches
+	if err := executeBlindCreateTxn(driver, "batch create", queriesCreatePartial, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute create queries: %w", err)
+	}
+	// Execute the soft delete queries in batches, which set deletedAt and updatedAt on every node still live
+	if err := executeSoftDeleteTxn(driver, "batch soft delete", queriesSoftDelete, batchSize, contentionRatio, 2); err != nil {
+		return fmt.Errorf("failed to execute soft delete queries: %w", err)
+	}
+	// Clear the graph
+	if err := resetGraph(driver); err != nil {
+		return fmt.Errorf("failed to clean up graph: %w", err)
+	}
+	return nil
+}
+
+func ExperimentBatchedSoftDeleteInTxnBatches(driver neo4j.DriverWithContext, queriesCreatePartial, queriesSoftDelete []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Experiment D4: Soft delete nodes using txn batched SET deletedAt queries
+	// Partially populate the graph in batches
+	if err := executeBlindCreateInTxnBatches(driver, "txn batch create", queriesCreatePartial, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute create queries: %w", err)
+	}
+	// Execute the soft delete queries in batches, which set deletedAt and updatedAt on every node still live
+	if err := executeSoftDeleteInTxnBatches(driver, "txn batch soft delete", queriesSoftDelete, batchSize, contentionRatio, 2); err != nil {
+		return fmt.Errorf("failed to execute soft delete queries: %w", err)
+	}
+	// Clear the graph
+	if err := resetGraph(driver); err != nil {
+		return fmt.Errorf("failed to clean up graph: %w", err)
+	}
+	return nil
+}
+
+func ExperimentBatchedEdgeDeleteInTxnBatches(driver neo4j.DriverWithContext, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, queriesDeleteEdges []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Experiment D5: Hard delete edges using txn batched DELETE queries
+	// Populate the endpoints and partially populate the edges in batches
+	if err := executeBlindCreateInTxnBatches(driver, "populate user nodes", queriesCreateUserNodes, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute create queries: %w", err)
+	}
+	if err := executeBlindCreateInTxnBatches(driver, "populate group nodes", queriesCreateGroupNodes, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute create queries: %w", err)
+	}
+	if err := executeBlindCreateInTxnBatches(driver, "populate edges", queriesCreateEdgesPartial, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute create queries: %w", err)
+	}
+	// Execute the delete queries in batches
+	if err := executeDeleteInTxnBatches(driver, "txn batch edge delete", queriesDeleteEdges, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute delete queries: %w", err)
+	}
+	// Clear the graph
+	if err := resetGraph(driver); err != nil {
+		return fmt.Errorf("failed to clean up graph: %w", err)
+	}
+	return nil
+}
+
+func ExperimentBatchedEdgeSoftDeleteInTxnBatches(driver neo4j.DriverWithContext, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, queriesSoftDeleteEdges []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Experiment D6: Soft delete edges using txn batched SET deletedAt queries
+	// Populate the endpoints and partially populate the edges in batches
+	if err := executeBlindCreateInTxnBatches(driver, "populate user nodes", queriesCreateUserNodes, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute create queries: %w", err)
+	}
+	if err := executeBlindCreateInTxnBatches(driver, "populate group nodes", queriesCreateGroupNodes, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute create queries: %w", err)
+	}
+	if err := executeBlindCreateInTxnBatches(driver, "populate edges", queriesCreateEdgesPartial, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute create queries: %w", err)
+	}
+	// Execute the soft delete queries in batches, which set deletedAt on every edge still live
+	if err := executeSoftDeleteInTxnBatches(driver, "txn batch edge soft delete", queriesSoftDeleteEdges, batchSize, contentionRatio, 1); err != nil {
+		return fmt.Errorf("failed to execute soft delete queries: %w", err)
+	}
+	// Clear the graph
+	if err := resetGraph(driver); err != nil {
+		return fmt.Errorf("failed to clean up graph: %w", err)
+	}
+	return nil
+}
+
+func ExperimentShellEntityReconciliationInTxnBatches(driver neo4j.DriverWithContext, queriesCreateUserNodesPartial, queriesCreateGroupNodesPartial, queriesCreateShellEdges, queriesMergeUserNodes, queriesMergeGroupNodes []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Experiment D7: Create edges to shell endpoints and then reconcile the shells with the real nodes in txn batches
+	// Partially populate the endpoints in batches
+	if err := executeBlindCreateInTxnBatches(driver, "populate user nodes", queriesCreateUserNodesPartial, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute create queries: %w", err)
+	}
+	if err := executeBlindCreateInTxnBatches(driver, "populate group nodes", queriesCreateGroupNodesPartial, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute create queries: %w", err)
+	}
+	// Create the edges, merging a shell node for every missing endpoint
+	if err := executeBlindCreateInTxnBatches(driver, "txn batch shell edges", queriesCreateShellEdges, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute shell edge queries: %w", err)
+	}
+	// Fill in the shell nodes
+	if err := executeBlindCreateInTxnBatches(driver, "txn batch reconcile users", queriesMergeUserNodes, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute reconcile queries: %w", err)
+	}
+	if err := executeBlindCreateInTxnBatches(driver, "txn batch reconcile groups", queriesMergeGroupNodes, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute reconcile queries: %w", err)
+	}
+	// Clear the graph
+	if err := resetGraph(driver); err != nil {
+		return fmt.Errorf("failed to clean up graph: %w", err)
+	}
+	return nil
+}
@@ -3,86 +3,107 @@ package main
 import (
 	"fmt"
 	"log"
-	"math"
 	"time"
 
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 	"golang.org/x/sync/errgroup"
 )
 
-func RunEdgeExperiments(log *log.Logger, driver neo4j.DriverWithContext) {
+func RunEdgeExperiments(log *log.Logger, driver neo4j.DriverWithContext) error {
 	log.Print("running experiments")
 	for _, batchSize := range batches {
 		log.Printf("batch size: %d", batchSize)
 		for _, contentionRatio := range contentionRatios {
 			log.Printf("contention ratio: %.2f", contentionRatio)
-			for run := 0; run < runs; run++ {
-				log.Printf("run: %d", run+1)
+			err := forEachRun(log, driver, batchSize, contentionRatio, func() error {
 				// Create test sets
 
 				// preCreatedObjects := int(contentionRatio * totalObjects)
 
+				users, groups, edges := generateGraph()
 				queriesCreateUserNodes := make([]ParamedCql, 0)
-				queriesCreateGroupNodes := make([]ParamedCql, 0)
-				for i := 0; i < int(math.Sqrt(totalObjects)); i++ {
+				for i := 0; i < users; i++ {
 					queriesCreateUserNodes = append(queriesCreateUserNodes, ParamedCql{
-						Query:  "CREATE (n:User{`~id`: $_id}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+						Query:  "CREATE (n:User{" + keyPattern("_id", "tenantId") + "}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
 						Params: getUserParams(i),
 					})
+				}
+				queriesCreateGroupNodes := make([]ParamedCql, 0)
+				for i := 0; i < groups; i++ {
 					queriesCreateGroupNodes = append(queriesCreateGroupNodes, ParamedCql{
-						Query:  "CREATE (n:Group{`~id`: $_id}) SET n += {id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+						Query:  "CREATE (n:Group{" + keyPattern("_id", "tenantId") + "}) SET n += {id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
 						Params: getGroupParams(i),
 					})
 				}
 
 				queriesCreateEdges := make([]ParamedCql, 0)
-				for i := 0; i < int(math.Sqrt(totalObjects)); i++ {
-					for j := 0; j < int(math.Sqrt(totalObjects)); j++ {
-						queriesCreateEdges = append(queriesCreateEdges, ParamedCql{
-							Query:  "MATCH (u:User{`~id`: $user_id}), (g:Group{`~id`: $group_id}) CREATE (g)-[r:GROUP_USER_BINDING{`~id`: $user_id + \".\" + $group_id}]->(u)",
-							Params: map[string]any{"user_id": fmt.Sprintf("user-%d", i), "group_id": fmt.Sprintf("group-%d", j)},
-						})
-					}
+				for _, edge := range edges {
+					queriesCreateEdges = append(queriesCreateEdges, ParamedCql{
+						Query:  "MATCH (u:User{" + keyPattern("user_id", "user_tenant") + "}), (g:Group{" + keyPattern("group_id", "group_tenant") + "}) CREATE (g)-[r:GROUP_USER_BINDING{`~id`: $_id}]->(u)",
+						Params: getEdgeParams(edge[0], edge[1]),
+					})
 				}
 
-				random := generateUniqueRandomNumbers(0, int(math.Sqrt(totalObjects)), int(math.Sqrt(totalObjects)*contentionRatio))
-
 				queriesUpdateUserNodes := make([]ParamedCql, 0)
-				queriesUpdateGroupNodes := make([]ParamedCql, 0)
-				for _, i := range random {
+				for _, i := range generateUniqueRandomNumbers(0, users, int(float64(users)*contentionRatio)) {
 					queriesUpdateUserNodes = append(queriesUpdateUserNodes, ParamedCql{
-						Query:  "MATCH (n:User{`~id`: $_id}) SET n += {name: $name + \"-Altered\", updatedAt: $updatedAt}",
+						Query:  "MATCH (n:User{" + keyPattern("_id", "tenantId") + "}) SET n += {name: $name + \"-Altered\", updatedAt: $updatedAt}",
 						Params: getUserParams(i),
 					})
+				}
+				queriesUpdateGroupNodes := make([]ParamedCql, 0)
+				for _, i := range generateUniqueRandomNumbers(0, groups, int(float64(groups)*contentionRatio)) {
 					queriesUpdateGroupNodes = append(queriesUpdateGroupNodes, ParamedCql{
-						Query:  "MATCH (n:Group{`~id`: $_id}) SET n += {name: $name + \"-Altered\", updatedAt: $updatedAt}",
+						Query:  "MATCH (n:Group{" + keyPattern("_id", "tenantId") + "}) SET n += {name: $name + \"-Altered\", updatedAt: $updatedAt}",
 						Params: getGroupParams(i),
 					})
 				}
 
-				// Clear the graph
-				if err := executeTxn(driver, "cleanup", 0, 0.0, cleanUpGraphTxn(), true); err != nil {
-					log.Fatalf("Failed to clean up graph: %v", err)
-				}
-				executeBlindCreateInTxnBatches(driver, "user nodes", queriesCreateUserNodes, batchSize, contentionRatio)
-				executeBlindCreateInTxnBatches(driver, "group nodes", queriesCreateGroupNodes, batchSize, contentionRatio)
-
-				g := new(errgroup.Group)
-				st := time.Now()
-				g.Go(func() error {
-					return executeBlindCreateInTxnBatches(driver, "edges", queriesCreateEdges, batchSize, contentionRatio)
-				})
-				g.Go(func() error {
-					return executeBlindCreateInTxnBatches(driver, "update user nodes", queriesUpdateUserNodes, batchSize, contentionRatio)
-				})
-				g.Go(func() error {
-					return executeBlindCreateInTxnBatches(driver, "update group nodes", queriesUpdateGroupNodes, batchSize, contentionRatio)
-				})
-				if err := g.Wait(); err != nil {
-					log.Fatalf("Failed to execute transactions: %v", err)
+				for _, ordering := range lockOrderings {
+					if err := ExperimentConcurrentEdgesAndUpdates(driver, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdges, queriesUpdateUserNodes, queriesUpdateGroupNodes, batchSize, contentionRatio, ordering); err != nil {
+						return err
+					}
 				}
-				latency("update operation", batchSize, contentionRatio, st, nil, nil, nil, nil)
+				return nil
+			})
+			if err != nil {
+				return err
 			}
 		}
 	}
+	return nil
+}
+
+func ExperimentConcurrentEdgesAndUpdates(driver neo4j.DriverWithContext, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdges, queriesUpdateUserNodes, queriesUpdateGroupNodes []ParamedCql, batchSize int, contentionRatio float64, ordering string) error {
+	// Order the batches by the nodes they lock
+	queriesCreateEdges, err := prepareBatches(queriesCreateEdges, ordering)
+	if err != nil {
+		return fmt.Errorf("failed to prepare batches: %w", err)
+	}
+	queriesUpdateUserNodes, _ = prepareBatches(queriesUpdateUserNodes, ordering)
+	queriesUpdateGroupNodes, _ = prepareBatches(queriesUpdateGroupNodes, ordering)
+
+	// Clear the graph
+	if err := resetGraph(driver); err != nil {
+		return fmt.Errorf("failed to clean up graph: %w", err)
+	}
+	executeBlindCreateInTxnBatches(driver, "user nodes", queriesCreateUserNodes, batchSize, contentionRatio)
+	executeBlindCreateInTxnBatches(driver, "group nodes", queriesCreateGroupNodes, batchSize, contentionRatio)
+
+	g := new(errgroup.Group)
+	st := time.Now()
+	g.Go(func() error {
+		return executeBlindCreateInTxnBatches(driver, withLockOrdering("edges", ordering), queriesCreateEdges, batchSize, contentionRatio)
+	})
+	g.Go(func() error {
+		return executeBlindCreateInTxnBatches(driver, withLockOrdering("update user nodes", ordering), queriesUpdateUserNodes, batchSize, contentionRatio)
+	})
+	g.Go(func() error {
+		return executeBlindCreateInTxnBatches(driver, withLockOrdering("update group nodes", ordering), queriesUpdateGroupNodes, batchSize, contentionRatio)
+	})
+	if err := g.Wait(); err != nil {
+		return fmt.Errorf("failed to execute transactions: %w", err)
+	}
+	latency(withLockOrdering("update operation", ordering), batchSize, contentionRatio, st, nil, nil, nil, nil)
+	return nil
 }
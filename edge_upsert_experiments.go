@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func RunEdgeUpsertExperiments(log *log.Logger, driver neo4j.DriverWithContext) error {
+	log.Print("running experiments")
+	for _, batchSize := range batches {
+		log.Printf("batch size: %d", batchSize)
+		for _, contentionRatio := range contentionRatios {
+			log.Printf("contention ratio: %.2f", contentionRatio)
+			for _, variant := range schemaVariants {
+				log.Printf("schema: %s", variant)
+				if err := applySchema(driver, variant); err != nil {
+					return fmt.Errorf("failed to apply schema: %w", err)
+				}
+				err := forEachRun(log, driver, batchSize, contentionRatio, func() error {
+					// Create test sets
+
+					users, groups, edges := generateGraph()
+					queriesCreateUserNodes := make([]ParamedCql, 0)
+					for i := 0; i < users; i++ {
+						queriesCreateUserNodes = append(queriesCreateUserNodes, ParamedCql{
+							Query:  "CREATE (n:User{" + keyPattern("_id", "tenantId") + "}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+							Params: getUserParams(i),
+						})
+					}
+					queriesCreateGroupNodes := make([]ParamedCql, 0)
+					for i := 0; i < groups; i++ {
+						queriesCreateGroupNodes = append(queriesCreateGroupNodes, ParamedCql{
+							Query:  "CREATE (n:Group{" + keyPattern("_id", "tenantId") + "}) SET n += {id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+							Params: getGroupParams(i),
+						})
+					}
+
+					// The contention ratio is the fraction of edges that already exist when the upsert runs
+					random := generateUniqueRandomNumbers(0, len(edges), int(float64(len(edges))*contentionRatio))
+					queriesCreateEdgesPartial := make([]ParamedCql, 0)
+					for _, e := range random {
+						queriesCreateEdgesPartial = append(queriesCreateEdgesPartial, ParamedCql{
+							Query:  "MATCH (u:User{" + keyPattern("user_id", "user_tenant") + "}), (g:Group{" + keyPattern("group_id", "group_tenant") + "}) CREATE (g)-[r:GROUP_USER_BINDING{`~id`: $_id}]->(u)",
+							Params: getEdgeParams(edges[e][0], edges[e][1]),
+						})
+					}
+					queriesCreateEdges := make([]ParamedCql, 0)
+					queriesMergeEdges := make([]ParamedCql, 0)
+					queriesMergeEndpointsAndEdges := make([]ParamedCql, 0)
+					for _, edge := range edges {
+						queriesCreateEdges = append(queriesCreateEdges, ParamedCql{
+							Query:  "MATCH (u:User{" + keyPattern("user_id", "user_tenant") + "}), (g:Group{" + keyPattern("group_id", "group_tenant") + "}) CREATE (g)-[r:GROUP_USER_BINDING{`~id`: $_id}]->(u)",
+							Entity: "GROUP_USER_BINDING",
+							Params: getEdgeParams(edge[0], edge[1]),
+						})
+						queriesMergeEdges = append(queriesMergeEdges, ParamedCql{
+							Query:  "MATCH (u:User{" + keyPattern("user_id", "user_tenant") + "}), (g:Group{" + keyPattern("group_id", "group_tenant") + "}) MERGE (g)-[r:GROUP_USER_BINDING{`~id`: $_id}]->(u)",
+							Entity: "GROUP_USER_BINDING",
+							Params: getEdgeParams(edge[0], edge[1]),
+						})
+						queriesMergeEndpointsAndEdges = append(queriesMergeEndpointsAndEdges, ParamedCql{
+							Query:  "MERGE (u:User{" + keyPattern("user_id", "user_tenant") + "}) ON CREATE SET u += {tenantId: $user_tenant, isShellEntity: true, deletedAt: null} MERGE (g:Group{" + keyPattern("group_id", "group_tenant") + "}) ON CREATE SET g += {tenantId: $group_tenant, isShellEntity: true, deletedAt: null} MERGE (g)-[r:GROUP_USER_BINDING{`~id`: $_id}]->(u)",
+							Entity: "GROUP_USER_BINDING",
+							Params: getEdgeParams(edge[0], edge[1]),
+						})
+					}
+
+					if err := ExperimentBatchedEdgeMerge(driver, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, queriesMergeEdges, batchSize, contentionRatio); err != nil {
+						return err
+					}
+					if err := ExperimentBatchedEdgeMergeInTxnBatches(driver, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, queriesMergeEdges, batchSize, contentionRatio); err != nil {
+						return err
+					}
+					if err := ExperimentBatchedEdgeMatchAndBatchedCreate(driver, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, queriesCreateEdges, batchSize, contentionRatio); err != nil {
+						return err
+					}
+					if err := ExperimentBatchedEdgeMatchAndBatchedCreateInTxnBatches(driver, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, queriesCreateEdges, batchSize, contentionRatio); err != nil {
+						return err
+					}
+					return ExperimentBatchedEndpointAndEdgeMergeInTxnBatches(driver, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, queriesMergeEndpointsAndEdges, batchSize, contentionRatio)
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	// Restore the schema the other experiments expect
+	if err := applySchema(driver, defaultSchema); err != nil {
+		return fmt.Errorf("failed to apply schema: %w", err)
+	}
+	return nil
+}
+
+// populateEdgeGraph creates all endpoints and the pre-existing fraction of edges
+func populateEdgeGraph(driver neo4j.DriverWithContext, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial []ParamedCql, batchSize int, contentionRatio float64) error {
+	if err := executeBlindCreateInTxnBatches(driver, "populate user nodes", queriesCreateUserNodes, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute create queries: %w", err)
+	}
+	if err := executeBlindCreateInTxnBatches(driver, "populate group nodes", queriesCreateGroupNodes, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute create queries: %w", err)
+	}
+	if err := executeBlindCreateInTxnBatches(driver, "populate edges", queriesCreateEdgesPartial, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute create queries: %w", err)
+	}
+	return nil
+}
+
+func ExperimentBatchedEdgeMerge(driver neo4j.DriverWithContext, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, queriesMergeEdges []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Experiment E1: Upsert edges using batched relationship MERGE queries
+	if err := populateEdgeGraph(driver, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, batchSize, contentionRatio); err != nil {
+		return err
+	}
+	// Execute the merge queries in batches
+	if err := executeBlindCreateTxn(driver, "batch edge merge", queriesMergeEdges, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute merge queries: %w", err)
+	}
+	// Clear the graph
+	if err := resetGraph(driver); err != nil {
+		return fmt.Errorf("failed to clean up graph: %w", err)
+	}
+	return nil
+}
+
+func ExperimentBatchedEdgeMergeInTxnBatches(driver neo4j.DriverWithContext, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, queriesMergeEdges []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Experiment E2: Upsert edges using txn batched relationship MERGE queries
+	if err := populateEdgeGraph(driver, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, batchSize, contentionRatio); err != nil {
+		return err
+	}
+	// Execute the merge queries in batches
+	if err := executeBlindCreateInTxnBatches(driver, "txn batch edge merge", queriesMergeEdges, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute merge queries: %w", err)
+	}
+	// Clear the graph
+	if err := resetGraph(driver); err != nil {
+		return fmt.Errorf("failed to clean up graph: %w", err)
+	}
+	return nil
+}
+
+func ExperimentBatchedEdgeMatchAndBatchedCreate(driver neo4j.DriverWithContext, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, queriesCreateEdges []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Experiment E3: Upsert edges by looking up existing edge ids in batches and creating only the missing ones
+	if err := populateEdgeGraph(driver, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, batchSize, contentionRatio); err != nil {
+		return err
+	}
+	// Execute the conditional create queries in batches
+	if err := executeMatchAndMutateTxn(driver, "batch edge match>create", queriesCreateEdges, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute match and create batch queries: %w", err)
+	}
+	// Clear the graph
+	if err := resetGraph(driver); err != nil {
+		return fmt.Errorf("failed to clean up graph: %w", err)
+	}
+	return nil
+}
+
+func ExperimentBatchedEdgeMatchAndBatchedCreateInTxnBatches(driver neo4j.DriverWithContext, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, queriesCreateEdges []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Experiment E4: Upsert edges by looking up existing edge ids in txn batches and creating only the missing ones
+	if err := populateEdgeGraph(driver, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, batchSize, contentionRatio); err != nil {
+		return err
+	}
+	// Execute the conditional create queries in batches
+	if err := executeMatchAndMutateInTxnBatches(driver, "txn batch edge match>create", queriesCreateEdges, batchSize, contentionRatio, false); err != nil {
+		return fmt.Errorf("failed to execute match and create batch queries: %w", err)
+	}
+	// Clear the graph
+	if err := resetGraph(driver); err != nil {
+		return fmt.Errorf("failed to clean up graph: %w", err)
+	}
+	return nil
+}
+
+func ExperimentBatchedEndpointAndEdgeMergeInTxnBatches(driver neo4j.DriverWithContext, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, queriesMergeEndpointsAndEdges []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Experiment E5: Upsert edges by merging both endpoints and the edge in one statement in txn batches
+	if err := populateEdgeGraph(driver, queriesCreateUserNodes, queriesCreateGroupNodes, queriesCreateEdgesPartial, batchSize, contentionRatio); err != nil {
+		return err
+	}
+	// Execute the merge queries in batches
+	if err := executeBlindCreateInTxnBatches(driver, "txn batch endpoint+edge merge", queriesMergeEndpointsAndEdges, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute merge queries: %w", err)
+	}
+	// Clear the graph
+	if err := resetGraph(driver); err != nil {
+		return fmt.Errorf("failed to clean up graph: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// environmentSettings are the server settings recorded with the results, those that bound what the server can cache
+var environmentSettings = []string{
+	"server.memory.heap.initial_size",
+	"server.memory.heap.max_size",
+	"server.memory.pagecache.size",
+	"server.memory.off_heap.transaction_max_size",
+	"db.memory.transaction.total.max",
+	"dbms.memory.transaction.total.max",
+}
+
+// environment is captured once connected and written alongside every result set, so that results from different
+// servers, clients or hosts are never compared unknowingly
+var environment [][2]string
+
+// environmentMap is the environment keyed by name, as written to JSON
+func environmentMap() map[string]string {
+	env := make(map[string]string)
+	for _, pair := range environment {
+		env[pair[0]] = pair[1]
+	}
+	return env
+}
+
+// environmentPath is the sidecar file the environment of a result set is written to, next to the result set itself
+func environmentPath(path string) string {
+	return path + ".env.json"
+}
+
+// writeEnvironment writes the environment as JSON to the sidecar file of a CSV result set, keeping the result set
+// itself plain CSV
+func writeEnvironment(path string) error {
+	content, err := json.MarshalIndent(environmentMap(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode environment: %w", err)
+	}
+	if err := os.WriteFile(environmentPath(path), content, 0o644); err != nil {
+		return fmt.Errorf("failed to write environment: %w", err)
+	}
+	return nil
+}
+
+// readEnvironment reads the environment from the sidecar file of a CSV result set, nil when there is none
+func readEnvironment(path string) (map[string]string, error) {
+	content, err := os.ReadFile(environmentPath(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read environment: %w", err)
+	}
+	env := make(map[string]string)
+	if err := json.Unmarshal(content, &env); err != nil {
+		return nil, fmt.Errorf("failed to decode environment: %w", err)
+	}
+	return env, nil
+}
+
+// captureEnvironment snapshots the server, the client and the host the results were produced with, as ordered pairs
+// of name and value. Whatever cannot be found out, such as settings the server does not let us list, is left out.
+func captureEnvironment(driver neo4j.DriverWithContext) [][2]string {
+	environment := [][2]string{
+		{"date", time.Now().Format(time.RFC3339)},
+		{"command", strings.Join(os.Args, " ")},
+	}
+
+	// Server
+	result, err := neo4j.ExecuteQuery(context.Background(), driver, "CALL dbms.components() YIELD name, versions, edition RETURN name, versions, edition", nil, neo4j.EagerResultTransformer, neo4j.ExecuteQueryWithDatabase(currentDatabase()))
+	if err != nil {
+		log.Printf("Failed to list server components: %v", err)
+	} else {
+		for _, record := range result.Records {
+			name, _ := record.Get("name")
+			versions, _ := record.Get("versions")
+			edition, _ := record.Get("edition")
+			environment = append(environment, [2]string{fmt.Sprintf("%s version", name), fmt.Sprintf("%v %v", versions, edition)})
+		}
+	}
+	result, err = neo4j.ExecuteQuery(context.Background(), driver, "SHOW SETTINGS YIELD name, value WHERE name IN $names RETURN name, value ORDER BY name", map[string]any{"names": environmentSettings}, neo4j.EagerResultTransformer, neo4j.ExecuteQueryWithDatabase(currentDatabase()))
+	if err != nil {
+		log.Printf("Failed to list server settings: %v", err)
+	} else {
+		for _, record := range result.Records {
+			name, _ := record.Get("name")
+			value, _ := record.Get("value")
+			environment = append(environment, [2]string{name.(string), fmt.Sprint(value)})
+		}
+	}
+
+	// Client
+	environment = append(environment, [2]string{"go version", runtime.Version()})
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/neo4j/neo4j-go-driver/v5" {
+				environment = append(environment, [2]string{"driver version", dep.Version})
+			}
+		}
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" || setting.Key == "vcs.modified" {
+				environment = append(environment, [2]string{setting.Key, setting.Value})
+			}
+		}
+	}
+	// Binaries built by go run are not stamped with the revision, so ask git
+	if !hasEnvironment(environment, "vcs.revision") {
+		if revision, err := exec.Command("git", "rev-parse", "HEAD").Output(); err == nil {
+			environment = append(environment, [2]string{"vcs.revision", strings.TrimSpace(string(revision))})
+		}
+	}
+
+	// Host
+	hostname, _ := os.Hostname()
+	environment = append(environment,
+		[2]string{"host", hostname},
+		[2]string{"os", runtime.GOOS + "/" + runtime.GOARCH},
+		[2]string{"cpus", fmt.Sprint(runtime.NumCPU())},
+	)
+	if cpu := procField("/proc/cpuinfo", "model name"); cpu != "" {
+		environment = append(environment, [2]string{"cpu", cpu})
+	}
+	if memory := procField("/proc/meminfo", "MemTotal"); memory != "" {
+		environment = append(environment, [2]string{"memory", memory})
+	}
+	return environment
+}
+
+func hasEnvironment(environment [][2]string, name string) bool {
+	for _, pair := range environment {
+		if pair[0] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// procField returns the value of the first "name: value" line of a /proc file, empty when there is none
+func procField(path, name string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.TrimSpace(key) == name {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -6,4 +6,7 @@ require (
 	github.com/montanaflynn/stats v0.7.1
 	github.com/neo4j/neo4j-go-driver/v5 v5.28.0
 	golang.org/x/sync v0.12.0
+	golang.org/x/term v0.30.0
 )
+
+require golang.org/x/sys v0.31.0 // indirect
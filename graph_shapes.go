@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+var (
+	graphShape            = "complete"
+	graphUsers            = 0
+	graphGroups           = 0
+	graphFanOut           = 10
+	graphEdgeProbability  = 0.1
+	graphPowerLawExponent = 2.0
+	graphSupernodes       = 1
+)
+
+// supernodeUsers is the least number of users of the supernode shape, so that every supernode gets at least as many
+// relationships
+const supernodeUsers = 100000
+
+// maxZipfDraws bounds the zipf draws per picked group of the power-law shape, as the draws pile up on the few groups
+// at the head of the distribution when the fan-out nears the number of groups
+const maxZipfDraws = 100
+
+// graphShapes generate the (user, group) pairs bound by a GROUP_USER_BINDING edge for the given number of users and
+// groups
+var graphShapes = map[string]func(users, groups int) [][2]int{
+	// Every user is bound to every group
+	"complete": func(users, groups int) [][2]int {
+		edges := make([][2]int, 0, users*groups)
+		for i := 0; i < users; i++ {
+			for j := 0; j < groups; j++ {
+				edges = append(edges, [2]int{i, j})
+			}
+		}
+		return edges
+	},
+	// Every user is bound to graphFanOut groups picked uniformly
+	"bipartite": func(users, groups int) [][2]int {
+		edges := make([][2]int, 0, users*graphFanOut)
+		for i := 0; i < users; i++ {
+			for _, j := range generateUniqueRandomNumbers(0, groups, min(graphFanOut, groups)) {
+				edges = append(edges, [2]int{i, j})
+			}
+		}
+		return edges
+	},
+	// Every user is bound to graphFanOut groups picked from a zipf distribution, so group degrees follow a power law
+	"power-law": func(users, groups int) [][2]int {
+		zipf := rand.NewZipf(rand.New(rand.NewSource(rand.Int63())), graphPowerLawExponent, 1, uint64(groups-1))
+		edges := make([][2]int, 0, users*graphFanOut)
+		fanOut := min(graphFanOut, groups)
+		for i := 0; i < users; i++ {
+			picked := make(map[int]struct{})
+			for draws := 0; len(picked) < fanOut && draws < maxZipfDraws*fanOut; draws++ {
+				j := int(zipf.Uint64())
+				if _, ok := picked[j]; !ok {
+					picked[j] = struct{}{}
+					edges = append(edges, [2]int{i, j})
+				}
+			}
+			// Fill up the fan-out with the groups left in the rare case the draws ran out
+			for _, j := range rand.Perm(groups) {
+				if len(picked) == fanOut {
+					break
+				}
+				if _, ok := picked[j]; !ok {
+					picked[j] = struct{}{}
+					edges = append(edges, [2]int{i, j})
+				}
+			}
+		}
+		return edges
+	},
+	// Every user is bound to each of the first graphSupernodes groups, plus graphFanOut of the remaining groups
+	"supernode": func(users, groups int) [][2]int {
+		supernodes := min(graphSupernodes, groups)
+		edges := make([][2]int, 0, users*(supernodes+graphFanOut))
+		for i := 0; i < users; i++ {
+			for j := 0; j < supernodes; j++ {
+				edges = append(edges, [2]int{i, j})
+			}
+			if groups > supernodes {
+				for _, j := range generateUniqueRandomNumbers(supernodes, groups, min(graphFanOut, groups-supernodes)) {
+					edges = append(edges, [2]int{i, j})
+				}
+			}
+		}
+		return edges
+	},
+	// Every (user, group) pair is bound independently with probability graphEdgeProbability
+	"erdos-renyi": func(users, groups int) [][2]int {
+		edges := make([][2]int, 0, int(float64(users*groups)*graphEdgeProbability))
+		for i := 0; i < users; i++ {
+			for j := 0; j < groups; j++ {
+				if rand.Float64() < graphEdgeProbability {
+					edges = append(edges, [2]int{i, j})
+				}
+			}
+		}
+		return edges
+	},
+}
+
+// graphSize returns the number of users and groups of the edge experiments. Unless overridden, both are
+// sqrt(totalObjects), except for the supernode shape which has totalObjects users and at least supernodeUsers, so that
+// every supernode gets a relationship from every one of 100k users or more.
+func graphSize() (int, int) {
+	users, groups := int(math.Sqrt(totalObjects)), int(math.Sqrt(totalObjects))
+	if graphShape == "supernode" {
+		users = max(totalObjects, supernodeUsers)
+	}
+	if graphUsers > 0 {
+		users = graphUsers
+	}
+	if graphGroups > 0 {
+		groups = graphGroups
+	}
+	return users, groups
+}
+
+// generateGraph returns the number of users and groups and the edges between them for the configured graph shape
+func generateGraph() (int, int, [][2]int) {
+	users, groups := graphSize()
+	return users, groups, graphShapes[graphShape](users, groups)
+}
+
+func validateGraphShape(shape string) error {
+	if _, ok := graphShapes[shape]; !ok {
+		return fmt.Errorf("unknown graph shape '%s'", shape)
+	}
+	return nil
+}
+
+// validateGraphParameters rejects the fan-outs and supernode counts the shapes cannot size their edges by and the edge
+// probabilities that are no probabilities
+func validateGraphParameters() error {
+	if graphFanOut < 0 {
+		return fmt.Errorf("invalid fan-out %d: expected 0 or more", graphFanOut)
+	}
+	if graphSupernodes < 0 {
+		return fmt.Errorf("invalid supernodes %d: expected 0 or more", graphSupernodes)
+	}
+	if graphEdgeProbability < 0 || graphEdgeProbability > 1 {
+		return fmt.Errorf("invalid edge probability %g: expected between 0 and 1", graphEdgeProbability)
+	}
+	return nil
+}
+
+// validateGraphExponent rejects the power-law exponents rand.NewZipf has no distribution for
+func validateGraphExponent() error {
+	if graphPowerLawExponent <= 1 {
+		return fmt.Errorf("invalid power-law exponent %g: expected above 1", graphPowerLawExponent)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -9,36 +10,9 @@ import (
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 )
 
-func getConstraintTxn() TxnWithMetadata {
-	return TxnWithMetadata{
-		Txn: func(tx neo4j.ManagedTransaction) (any, error) {
-			nodes := []string{
-				"User",
-				"Group",
-			}
-			relationships := []string{
-				"GROUP_USER_BINDING",
-			}
-			for _, node := range nodes {
-				_, err := tx.Run(context.Background(), fmt.Sprintf("CREATE CONSTRAINT %s_id IF NOT EXISTS FOR (n:%s) REQUIRE n.`~id` IS UNIQUE", strings.ToLower(node), node), nil)
-				if err != nil {
-					return nil, fmt.Errorf("failed to create constraint: %w", err)
-				}
-			}
-			for _, relationship := range relationships {
-				_, err := tx.Run(context.Background(), fmt.Sprintf("CREATE CONSTRAINT %s_id IF NOT EXISTS FOR ()-[r:%s]-() REQUIRE r.`~id` IS UNIQUE", strings.ToLower(relationship), relationship), nil)
-				if err != nil {
-					return nil, fmt.Errorf("failed to create constraint: %w", err)
-				}
-			}
-			return nil, nil
-		},
-	}
-}
-
 func cleanUpGraphTxn() TxnWithMetadata {
 	return TxnWithMetadata{
-		Txn: func(tx neo4j.ManagedTransaction) (any, error) {
+		Txn: func(tx transaction) (any, error) {
 			_, err := tx.Run(context.Background(), "MATCH (n) DETACH DELETE n", nil)
 			if err != nil {
 				return nil, fmt.Errorf("failed to clean up graph: %w", err)
@@ -48,24 +22,120 @@ func cleanUpGraphTxn() TxnWithMetadata {
 	}
 }
 
+// relationshipTypes are the entities that are looked up as relationships rather than nodes
+var relationshipTypes = map[string]struct{}{
+	"GROUP_USER_BINDING": {},
+}
+
+// entityPattern returns the pattern binding n to an entity, so that the executors can look up nodes and relationships
+// by `~id` alike
+func entityPattern(entity string) string {
+	if _, ok := relationshipTypes[entity]; ok {
+		return fmt.Sprintf("()-[n:%s]->()", entity)
+	}
+	return fmt.Sprintf("(n:%s)", entity)
+}
+
+// lookupEntities returns the lookup binding n to every entity of the batch that exists, by a list of their keys or by
+// unwinding them, along with its parameters. The nodes are looked up by their tenant as well when ids are only unique
+// within a tenant.
+func lookupEntities(batch []ParamedCql, unwind bool) (string, map[string]any) {
+	entity := batch[0].Entity
+	pattern := entityPattern(entity)
+	if !tenantScoped(entity) {
+		ids := make([]string, 0)
+		for _, query := range batch {
+			ids = append(ids, query.Params["_id"].(string))
+		}
+		if unwind {
+			return fmt.Sprintf("UNWIND $_ids AS _id MATCH %s WHERE n.`~id` = _id", pattern), map[string]any{"_ids": ids}
+		}
+		return fmt.Sprintf("MATCH %s WHERE n.`~id` IN $_ids", pattern), map[string]any{"_ids": ids}
+	}
+	if unwind {
+		entities := make([]map[string]any, 0)
+		for _, query := range batch {
+			entities = append(entities, map[string]any{"tenantId": query.Params["tenantId"], "_id": query.Params["_id"]})
+		}
+		return fmt.Sprintf("UNWIND $_entities AS _entity MATCH %s WHERE n.tenantId = _entity.tenantId AND n.`~id` = _entity._id", pattern), map[string]any{"_entities": entities}
+	}
+	// The tenants and the ids seek the composite index, and the keys keep the pairs of them that are in the batch
+	tenants, ids, keys := make([]string, 0), make([]string, 0), make([]string, 0)
+	seen := make(map[string]bool)
+	for _, query := range batch {
+		tenant := query.Params["tenantId"].(string)
+		if !seen[tenant] {
+			seen[tenant] = true
+			tenants = append(tenants, tenant)
+		}
+		ids = append(ids, query.Params["_id"].(string))
+		keys = append(keys, entityKey(entity, query.Params))
+	}
+	return fmt.Sprintf("MATCH %s WHERE n.tenantId IN $_tenants AND n.`~id` IN $_ids AND %s IN $_keys", pattern, entityKeyExpression(entity)),
+		map[string]any{"_tenants": tenants, "_ids": ids, "_keys": keys}
+}
+
+// isDeadlock reports whether the error is the transient deadlock error that makes the driver retry a transaction
+func isDeadlock(err error) bool {
+	var neo4jErr *neo4j.Neo4jError
+	return errors.As(err, &neo4jErr) && neo4jErr.Code == "Neo.TransientError.Transaction.DeadlockDetected"
+}
+
+// attemptCounter counts the attempts at the transaction work of an executor and the deadlocks they ran into
+type attemptCounter struct {
+	attempts  int
+	deadlocks int
+	failed    bool
+}
+
+// count wraps the work to classify the error of every attempt, wherever in the work it came from
+func (c *attemptCounter) count(work transactionWork) transactionWork {
+	return func(tx transaction) (any, error) {
+		c.attempts++
+		result, err := work(tx)
+		c.failed = err != nil
+		if isDeadlock(err) {
+			c.deadlocks++
+		}
+		return result, err
+	}
+}
+
+// settle classifies the error the transaction ended with, which did not come from the work when the commit failed
+func (c *attemptCounter) settle(err error) {
+	if err != nil && !c.failed && isDeadlock(err) {
+		c.deadlocks++
+	}
+}
+
 // executeTxn executes a transaction
 func executeTxn(driver neo4j.DriverWithContext, name string, batchSize int, contentionRatio float64, txn TxnWithMetadata, suppressMetrics bool) error {
 	// Create a session
 	session := driver.NewSession(context.Background(), neo4j.SessionConfig{
-		AccessMode: neo4j.AccessModeWrite,
+		AccessMode:   neo4j.AccessModeWrite,
+		DatabaseName: currentDatabase(),
 	})
+	var run *execution
 	if !suppressMetrics {
-		defer latency(name, batchSize, contentionRatio, time.Now(), &txn.CountReadObjects, &txn.CountWriteObjects, &txn.CountReadQueries, &txn.CountWriteQueries)
+		run = measure(name, batchSize, contentionRatio, &txn.CountReadObjects, &txn.CountWriteObjects, &txn.CountReadQueries, &txn.CountWriteQueries)
+		defer run.finish()
 	}
 	defer session.Close(context.Background())
 
-	// Execute the transaction
-	_, err := session.ExecuteWrite(context.Background(), txn.Txn)
+	// Execute the transaction, leaving the housekeeping ones out of the profiling and priming passes
+	work := txn.Txn
+	if !suppressMetrics {
+		work = instrumented(run, work)
+	}
+	_, err := executeWrite(session, work)
+	if err != nil && suppressMetrics {
+		countTransactionError(err)
+	}
 	return err
 }
 
-func getParamedCqlTxn(queries []ParamedCql) neo4j.ManagedTransactionWork {
-	return func(tx neo4j.ManagedTransaction) (any, error) {
+func getParamedCqlTxn(queries []ParamedCql) transactionWork {
+	return func(tx transaction) (any, error) {
 		for _, query := range queries {
 			_, err := tx.Run(context.Background(), query.Query, query.Params)
 			if err != nil {
@@ -79,15 +149,19 @@ func getParamedCqlTxn(queries []ParamedCql) neo4j.ManagedTransactionWork {
 func executeBlindCreateTxn(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64) error {
 	// Create a session
 	session := driver.NewSession(context.Background(), neo4j.SessionConfig{
-		AccessMode: neo4j.AccessModeWrite,
+		AccessMode:   neo4j.AccessModeWrite,
+		DatabaseName: currentDatabase(),
 	})
-	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries := 0, 0, 0, 0
-	defer latency(name, batchSize, contentionRatio, time.Now(), &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries)
+	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries, countRetries, countDeadlocks := 0, 0, 0, 0, 0, 0
+	run := measureWithRetries(name, batchSize, contentionRatio, &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries, &countRetries, &countDeadlocks)
+	defer run.finish()
 	defer session.Close(context.Background())
 
-	// Execute the transaction
-	_, err := session.ExecuteWrite(context.Background(),
-		func(tx neo4j.ManagedTransaction) (any, error) {
+	// Execute the transaction, keeping only the counts of the attempt that committed
+	attempts := &attemptCounter{}
+	_, err := executeWrite(session, attempts.count(instrumented(run,
+		func(tx transaction) (any, error) {
+			countWriteObjects = 0
 			for i := 0; i < len(queries); i += batchSize {
 				batch := queries[i:min(i+batchSize, len(queries))]
 				createQueryParams := make([]map[string]any, 0)
@@ -99,36 +173,54 @@ func executeBlindCreateTxn(driver neo4j.DriverWithContext, name string, queries
 				newQuery := "UNWIND $params AS param " + strings.ReplaceAll(queries[i].Query, "$", "param.")
 				_, err := tx.Run(context.Background(), newQuery, map[string]any{"params": createQueryParams})
 				countWriteQueries++
+				run.observe(countReadObjects + countWriteObjects)
 				if err != nil {
 					return nil, fmt.Errorf("failed to execute query '%s': %w", newQuery, err)
 				}
 
 			}
 			return nil, nil
-		},
+		})),
 	)
+	attempts.settle(err)
+	countRetries += max(attempts.attempts-1, 0)
+	countDeadlocks += attempts.deadlocks
 	return err
 }
 
 func executeBlindCreateInTxnBatches(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64) error {
+	return executeBlindCreateInSizedTxnBatches(driver, name, queries, batchSize, contentionRatio, false)
+}
+
+// executeBlindCreateInSizedTxnBatches is executeBlindCreateInTxnBatches with batch sizes adapted to the transaction
+// latency when adaptive is set
+func executeBlindCreateInSizedTxnBatches(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64, adaptive bool) error {
+	sizer := newBatchSizer(batchSize, adaptive)
+	name = sizer.label(name)
 	// Create a session
 	session := driver.NewSession(context.Background(), neo4j.SessionConfig{
-		AccessMode: neo4j.AccessModeWrite,
+		AccessMode:   neo4j.AccessModeWrite,
+		DatabaseName: currentDatabase(),
 	})
-	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries := 0, 0, 0, 0
-	defer latency(name, batchSize, contentionRatio, time.Now(), &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries)
+	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries, countRetries, countDeadlocks := 0, 0, 0, 0, 0, 0
+	run := measureWithRetries(name, batchSize, contentionRatio, &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries, &countRetries, &countDeadlocks)
+	defer run.finish()
 	defer session.Close(context.Background())
 
 	// Execute the transaction
-	for i := 0; i < len(queries); i += batchSize {
-		_, err := session.ExecuteWrite(context.Background(),
-			func(tx neo4j.ManagedTransaction) (any, error) {
-				batch := queries[i:min(i+batchSize, len(queries))]
+	var size int
+	for i := 0; i < len(queries); i += size {
+		size = sizer.size()
+		start := time.Now()
+		attempts, created := &attemptCounter{}, 0
+		_, err := executeWrite(session, attempts.count(instrumented(run,
+			func(tx transaction) (any, error) {
+				batch := queries[i:min(i+size, len(queries))]
 				createQueryParams := make([]map[string]any, 0)
 				for _, query := range batch {
 					createQueryParams = append(createQueryParams, query.Params)
-					countWriteObjects++
 				}
+				created = len(batch)
 				// transform "$" in query to "param."
 				newQuery := "UNWIND $params AS param " + strings.ReplaceAll(queries[i].Query, "$", "param.")
 				_, err := tx.Run(context.Background(), newQuery, map[string]any{"params": createQueryParams})
@@ -138,8 +230,16 @@ func executeBlindCreateInTxnBatches(driver neo4j.DriverWithContext, name string,
 				}
 
 				return nil, nil
-			},
+			})),
 		)
+		attempts.settle(err)
+		sizer.observe(time.Since(start), attempts.attempts > 1)
+		if err == nil {
+			countWriteObjects += created
+		}
+		run.observe(countReadObjects + countWriteObjects)
+		countRetries += max(attempts.attempts-1, 0)
+		countDeadlocks += attempts.deadlocks
 		if err != nil {
 			return err
 		}
@@ -148,27 +248,166 @@ func executeBlindCreateInTxnBatches(driver neo4j.DriverWithContext, name string,
 	return nil
 }
 
-func executeMatchAndMutateTxn(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64) error {
+// changedObjects counts the objects a query changed, from the counters of its summary
+func changedObjects(result neo4j.ResultWithContext, changed func(neo4j.Counters) int) (int, error) {
+	summary, err := result.Consume(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	return changed(summary.Counters()), nil
+}
+
+// deletedObjects counts the nodes and relationships a query deleted
+func deletedObjects(counters neo4j.Counters) int {
+	return counters.NodesDeleted() + counters.RelationshipsDeleted()
+}
+
+// softDeletedObjects counts the objects a soft delete query marked as deleted, from the properties it sets on each
+func softDeletedObjects(properties int) func(neo4j.Counters) int {
+	return func(counters neo4j.Counters) int {
+		return counters.PropertiesSet() / properties
+	}
+}
+
+// executeDeleteTxn is executeBlindCreateTxn for delete queries, counting the objects actually deleted rather than the
+// rows pushed, as only part of the deleted objects may exist
+func executeDeleteTxn(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64) error {
+	return executeChangeTxn(driver, name, queries, batchSize, contentionRatio, deletedObjects)
+}
+
+// executeSoftDeleteTxn is executeDeleteTxn for soft delete queries setting the given number of properties on every
+// object they mark as deleted, which skip the objects already marked
+func executeSoftDeleteTxn(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64, properties int) error {
+	return executeChangeTxn(driver, name, queries, batchSize, contentionRatio, softDeletedObjects(properties))
+}
+
+// executeChangeTxn is executeBlindCreateTxn counting the objects the queries changed, as told by their counters
+func executeChangeTxn(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64, changed func(neo4j.Counters) int) error {
 	// Create a session
 	session := driver.NewSession(context.Background(), neo4j.SessionConfig{
-		AccessMode: neo4j.AccessModeWrite,
+		AccessMode:   neo4j.AccessModeWrite,
+		DatabaseName: currentDatabase(),
 	})
-	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries := 0, 0, 0, 0
-	defer latency(name, batchSize, contentionRatio, time.Now(), &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries)
+	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries, countRetries, countDeadlocks := 0, 0, 0, 0, 0, 0
+	run := measureWithRetries(name, batchSize, contentionRatio, &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries, &countRetries, &countDeadlocks)
+	defer run.finish()
 	defer session.Close(context.Background())
 
-	// Execute the transaction
-	_, err := session.ExecuteWrite(context.Background(),
-		func(tx neo4j.ManagedTransaction) (any, error) {
+	// Execute the transaction, keeping only the counts of the attempt that committed
+	attempts := &attemptCounter{}
+	_, err := executeWrite(session, attempts.count(instrumented(run,
+		func(tx transaction) (any, error) {
+			countWriteObjects = 0
 			for i := 0; i < len(queries); i += batchSize {
 				batch := queries[i:min(i+batchSize, len(queries))]
-				searchQuery := fmt.Sprintf("MATCH (n:%s) WHERE n.`~id` IN $_ids RETURN COLLECT(n.`~id`) as entityIds", queries[i].Entity)
-				ids := make([]string, 0)
+				deleteQueryParams := make([]map[string]any, 0)
+				for _, query := range batch {
+					deleteQueryParams = append(deleteQueryParams, query.Params)
+				}
+				// transform "$" in query to "param."
+				newQuery := "UNWIND $params AS param " + strings.ReplaceAll(queries[i].Query, "$", "param.")
+				result, err := tx.Run(context.Background(), newQuery, map[string]any{"params": deleteQueryParams})
+				countWriteQueries++
+				if err == nil {
+					var deleted int
+					deleted, err = changedObjects(result, changed)
+					countWriteObjects += deleted
+				}
+				run.observe(countReadObjects + countWriteObjects)
+				if err != nil {
+					return nil, fmt.Errorf("failed to execute query '%s': %w", newQuery, err)
+				}
+			}
+			return nil, nil
+		})),
+	)
+	attempts.settle(err)
+	countRetries += max(attempts.attempts-1, 0)
+	countDeadlocks += attempts.deadlocks
+	return err
+}
+
+// executeDeleteInTxnBatches is executeBlindCreateInTxnBatches for delete queries, counting the objects actually deleted
+func executeDeleteInTxnBatches(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64) error {
+	return executeChangeInTxnBatches(driver, name, queries, batchSize, contentionRatio, deletedObjects)
+}
+
+// executeSoftDeleteInTxnBatches is executeSoftDeleteTxn in a transaction per batch
+func executeSoftDeleteInTxnBatches(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64, properties int) error {
+	return executeChangeInTxnBatches(driver, name, queries, batchSize, contentionRatio, softDeletedObjects(properties))
+}
+
+// executeChangeInTxnBatches is executeChangeTxn in a transaction per batch
+func executeChangeInTxnBatches(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64, changed func(neo4j.Counters) int) error {
+	// Create a session
+	session := driver.NewSession(context.Background(), neo4j.SessionConfig{
+		AccessMode:   neo4j.AccessModeWrite,
+		DatabaseName: currentDatabase(),
+	})
+	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries, countRetries, countDeadlocks := 0, 0, 0, 0, 0, 0
+	run := measureWithRetries(name, batchSize, contentionRatio, &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries, &countRetries, &countDeadlocks)
+	defer run.finish()
+	defer session.Close(context.Background())
+
+	// Execute the transaction
+	for i := 0; i < len(queries); i += batchSize {
+		attempts, deleted := &attemptCounter{}, 0
+		_, err := executeWrite(session, attempts.count(instrumented(run,
+			func(tx transaction) (any, error) {
+				batch := queries[i:min(i+batchSize, len(queries))]
+				deleteQueryParams := make([]map[string]any, 0)
 				for _, query := range batch {
-					ids = append(ids, query.Params["_id"].(string))
+					deleteQueryParams = append(deleteQueryParams, query.Params)
 				}
-				// fmt.Println(i, searchQuery, map[string]any{"_ids": ids})
-				result, err := tx.Run(context.Background(), searchQuery, map[string]any{"_ids": ids})
+				// transform "$" in query to "param."
+				newQuery := "UNWIND $params AS param " + strings.ReplaceAll(queries[i].Query, "$", "param.")
+				result, err := tx.Run(context.Background(), newQuery, map[string]any{"params": deleteQueryParams})
+				countWriteQueries++
+				if err == nil {
+					deleted, err = changedObjects(result, changed)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("failed to execute query '%s': %w", newQuery, err)
+				}
+
+				return nil, nil
+			})),
+		)
+		attempts.settle(err)
+		if err == nil {
+			countWriteObjects += deleted
+		}
+		run.observe(countReadObjects + countWriteObjects)
+		countRetries += max(attempts.attempts-1, 0)
+		countDeadlocks += attempts.deadlocks
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func executeMatchAndMutateTxn(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Create a session
+	session := driver.NewSession(context.Background(), neo4j.SessionConfig{
+		AccessMode:   neo4j.AccessModeWrite,
+		DatabaseName: currentDatabase(),
+	})
+	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries := 0, 0, 0, 0
+	run := measure(name, batchSize, contentionRatio, &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries)
+	defer run.finish()
+	defer session.Close(context.Background())
+
+	// Execute the transaction, keeping only the counts of the attempt that committed
+	_, err := executeWrite(session, instrumented(run,
+		func(tx transaction) (any, error) {
+			countReadObjects, countWriteObjects = 0, 0
+			for i := 0; i < len(queries); i += batchSize {
+				batch := queries[i:min(i+batchSize, len(queries))]
+				lookup, lookupParams := lookupEntities(batch, false)
+				searchQuery := lookup + " RETURN COLLECT(" + entityKeyExpression(queries[i].Entity) + ") as entityIds"
+				result, err := tx.Run(context.Background(), searchQuery, lookupParams)
 				countReadQueries++
 				if err != nil {
 					return nil, fmt.Errorf("failed to execute query '%s': %w", searchQuery, err)
@@ -189,7 +428,7 @@ func executeMatchAndMutateTxn(driver neo4j.DriverWithContext, name string, queri
 				// fmt.Println(foundIds)
 				createQueryParams := make([]map[string]any, 0)
 				for _, query := range batch {
-					if _, ok := foundIds[query.Params["_id"].(string)]; !ok {
+					if _, ok := foundIds[entityKey(query.Entity, query.Params)]; !ok {
 						createQueryParams = append(createQueryParams, query.Params)
 						countWriteObjects++
 					}
@@ -198,13 +437,14 @@ func executeMatchAndMutateTxn(driver neo4j.DriverWithContext, name string, queri
 				newQuery := "UNWIND $params AS param " + strings.ReplaceAll(queries[i].Query, "$", "param.")
 				_, err = tx.Run(context.Background(), newQuery, map[string]any{"params": createQueryParams})
 				countWriteQueries++
+				run.observe(countReadObjects + countWriteObjects)
 				if err != nil {
 					return nil, fmt.Errorf("failed to execute query '%s': %w", newQuery, err)
 				}
 
 			}
 			return nil, nil
-		},
+		}),
 	)
 	return err
 }
@@ -212,24 +452,23 @@ func executeMatchAndMutateTxn(driver neo4j.DriverWithContext, name string, queri
 func executeMatchWithUnwindAndMutateTxn(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64) error {
 	// Create a session
 	session := driver.NewSession(context.Background(), neo4j.SessionConfig{
-		AccessMode: neo4j.AccessModeWrite,
+		AccessMode:   neo4j.AccessModeWrite,
+		DatabaseName: currentDatabase(),
 	})
 	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries := 0, 0, 0, 0
-	defer latency(name, batchSize, contentionRatio, time.Now(), &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries)
+	run := measure(name, batchSize, contentionRatio, &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries)
+	defer run.finish()
 	defer session.Close(context.Background())
 
-	// Execute the transaction
-	_, err := session.ExecuteWrite(context.Background(),
-		func(tx neo4j.ManagedTransaction) (any, error) {
+	// Execute the transaction, keeping only the counts of the attempt that committed
+	_, err := executeWrite(session, instrumented(run,
+		func(tx transaction) (any, error) {
+			countReadObjects, countWriteObjects = 0, 0
 			for i := 0; i < len(queries); i += batchSize {
 				batch := queries[i:min(i+batchSize, len(queries))]
-				searchQuery := fmt.Sprintf("UNWIND $_ids AS _id MATCH (n:%s) WHERE n.`~id` = _id RETURN COLLECT(n.`~id`) AS entityIds", queries[i].Entity)
-				ids := make([]string, 0)
-				for _, query := range batch {
-					ids = append(ids, query.Params["_id"].(string))
-				}
-				// fmt.Println(i, searchQuery, map[string]any{"_ids": ids})
-				result, err := tx.Run(context.Background(), searchQuery, map[string]any{"_ids": ids})
+				lookup, lookupParams := lookupEntities(batch, true)
+				searchQuery := lookup + " RETURN COLLECT(" + entityKeyExpression(queries[i].Entity) + ") AS entityIds"
+				result, err := tx.Run(context.Background(), searchQuery, lookupParams)
 				countReadQueries++
 				if err != nil {
 					return nil, fmt.Errorf("failed to execute query '%s': %w", searchQuery, err)
@@ -250,7 +489,7 @@ func executeMatchWithUnwindAndMutateTxn(driver neo4j.DriverWithContext, name str
 				// fmt.Println(foundIds)
 				createQueryParams := make([]map[string]any, 0)
 				for _, query := range batch {
-					if _, ok := foundIds[query.Params["_id"].(string)]; !ok {
+					if _, ok := foundIds[entityKey(query.Entity, query.Params)]; !ok {
 						createQueryParams = append(createQueryParams, query.Params)
 						countWriteObjects++
 					}
@@ -259,38 +498,44 @@ func executeMatchWithUnwindAndMutateTxn(driver neo4j.DriverWithContext, name str
 				newQuery := "UNWIND $params AS param " + strings.ReplaceAll(queries[i].Query, "$", "param.")
 				_, err = tx.Run(context.Background(), newQuery, map[string]any{"params": createQueryParams})
 				countWriteQueries++
+				run.observe(countReadObjects + countWriteObjects)
 				if err != nil {
 					return nil, fmt.Errorf("failed to execute query '%s': %w", newQuery, err)
 				}
 
 			}
 			return nil, nil
-		},
+		}),
 	)
 	return err
 }
 
-func executeMatchAndMutateInTxnBatches(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64) error {
+func executeMatchAndMutateInTxnBatches(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64, adaptive bool) error {
+	sizer := newBatchSizer(batchSize, adaptive)
+	name = sizer.label(name)
 	// Create a session
 	session := driver.NewSession(context.Background(), neo4j.SessionConfig{
-		AccessMode: neo4j.AccessModeWrite,
+		AccessMode:   neo4j.AccessModeWrite,
+		DatabaseName: currentDatabase(),
 	})
-	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries := 0, 0, 0, 0
-	defer latency(name, batchSize, contentionRatio, time.Now(), &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries)
+	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries, countRetries, countDeadlocks := 0, 0, 0, 0, 0, 0
+	run := measureWithRetries(name, batchSize, contentionRatio, &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries, &countRetries, &countDeadlocks)
+	defer run.finish()
 	defer session.Close(context.Background())
 
-	// Execute the transaction
-	for i := 0; i < len(queries); i += batchSize {
-		_, err := session.ExecuteWrite(context.Background(),
-			func(tx neo4j.ManagedTransaction) (any, error) {
-				batch := queries[i:min(i+batchSize, len(queries))]
-				searchQuery := fmt.Sprintf("MATCH (n:%s) WHERE n.`~id` IN $_ids RETURN COLLECT(n.`~id`) as entityIds", queries[i].Entity)
-				ids := make([]string, 0)
-				for _, query := range batch {
-					ids = append(ids, query.Params["_id"].(string))
-				}
-				// fmt.Println(i, searchQuery, map[string]any{"_ids": ids})
-				result, err := tx.Run(context.Background(), searchQuery, map[string]any{"_ids": ids})
+	// Execute the transaction, keeping only the counts of the attempt that committed
+	var size int
+	for i := 0; i < len(queries); i += size {
+		size = sizer.size()
+		start := time.Now()
+		attempts, read, written := &attemptCounter{}, 0, 0
+		_, err := executeWrite(session, attempts.count(instrumented(run,
+			func(tx transaction) (any, error) {
+				read, written = 0, 0
+				batch := queries[i:min(i+size, len(queries))]
+				lookup, lookupParams := lookupEntities(batch, false)
+				searchQuery := lookup + " RETURN COLLECT(" + entityKeyExpression(queries[i].Entity) + ") as entityIds"
+				result, err := tx.Run(context.Background(), searchQuery, lookupParams)
 				countReadQueries++
 				if err != nil {
 					return nil, fmt.Errorf("failed to execute query '%s': %w", searchQuery, err)
@@ -305,15 +550,15 @@ func executeMatchAndMutateInTxnBatches(driver neo4j.DriverWithContext, name stri
 					foundIdSlice := foundIdsAny.([]any)
 					for _, id := range foundIdSlice {
 						foundIds[id.(string)] = struct{}{}
-						countReadObjects++
+						read++
 					}
 				}
 				// fmt.Println(foundIds)
 				createQueryParams := make([]map[string]any, 0)
 				for _, query := range batch {
-					if _, ok := foundIds[query.Params["_id"].(string)]; !ok {
+					if _, ok := foundIds[entityKey(query.Entity, query.Params)]; !ok {
 						createQueryParams = append(createQueryParams, query.Params)
-						countWriteObjects++
+						written++
 					}
 				}
 				// transform "$" in query to "param."
@@ -325,8 +570,17 @@ func executeMatchAndMutateInTxnBatches(driver neo4j.DriverWithContext, name stri
 				}
 
 				return nil, nil
-			},
+			})),
 		)
+		attempts.settle(err)
+		sizer.observe(time.Since(start), attempts.attempts > 1)
+		if err == nil {
+			countReadObjects += read
+			countWriteObjects += written
+		}
+		run.observe(countReadObjects + countWriteObjects)
+		countRetries += max(attempts.attempts-1, 0)
+		countDeadlocks += attempts.deadlocks
 		if err != nil {
 			return err
 		}
@@ -334,27 +588,32 @@ func executeMatchAndMutateInTxnBatches(driver neo4j.DriverWithContext, name stri
 	return nil
 }
 
-func executeMatchWithUnwindAndMutateInTxnBatches(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64) error {
+func executeMatchWithUnwindAndMutateInTxnBatches(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64, adaptive bool) error {
+	sizer := newBatchSizer(batchSize, adaptive)
+	name = sizer.label(name)
 	// Create a session
 	session := driver.NewSession(context.Background(), neo4j.SessionConfig{
-		AccessMode: neo4j.AccessModeWrite,
+		AccessMode:   neo4j.AccessModeWrite,
+		DatabaseName: currentDatabase(),
 	})
-	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries := 0, 0, 0, 0
-	defer latency(name, batchSize, contentionRatio, time.Now(), &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries)
+	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries, countRetries, countDeadlocks := 0, 0, 0, 0, 0, 0
+	run := measureWithRetries(name, batchSize, contentionRatio, &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries, &countRetries, &countDeadlocks)
+	defer run.finish()
 	defer session.Close(context.Background())
 
-	// Execute the transaction
-	for i := 0; i < len(queries); i += batchSize {
-		_, err := session.ExecuteWrite(context.Background(),
-			func(tx neo4j.ManagedTransaction) (any, error) {
-				batch := queries[i:min(i+batchSize, len(queries))]
-				searchQuery := fmt.Sprintf("UNWIND $_ids AS _id MATCH (n:%s) WHERE n.`~id` = _id RETURN COLLECT(n.`~id`) AS entityIds", queries[i].Entity)
-				ids := make([]string, 0)
-				for _, query := range batch {
-					ids = append(ids, query.Params["_id"].(string))
-				}
-				// fmt.Println(i, searchQuery, map[string]any{"_ids": ids})
-				result, err := tx.Run(context.Background(), searchQuery, map[string]any{"_ids": ids})
+	// Execute the transaction, keeping only the counts of the attempt that committed
+	var size int
+	for i := 0; i < len(queries); i += size {
+		size = sizer.size()
+		start := time.Now()
+		attempts, read, written := &attemptCounter{}, 0, 0
+		_, err := executeWrite(session, attempts.count(instrumented(run,
+			func(tx transaction) (any, error) {
+				read, written = 0, 0
+				batch := queries[i:min(i+size, len(queries))]
+				lookup, lookupParams := lookupEntities(batch, true)
+				searchQuery := lookup + " RETURN COLLECT(" + entityKeyExpression(queries[i].Entity) + ") AS entityIds"
+				result, err := tx.Run(context.Background(), searchQuery, lookupParams)
 				countReadQueries++
 				if err != nil {
 					return nil, fmt.Errorf("failed to execute query '%s': %w", searchQuery, err)
@@ -369,15 +628,15 @@ func executeMatchWithUnwindAndMutateInTxnBatches(driver neo4j.DriverWithContext,
 					foundIdSlice := foundIdsAny.([]any)
 					for _, id := range foundIdSlice {
 						foundIds[id.(string)] = struct{}{}
-						countReadObjects++
+						read++
 					}
 				}
 				// fmt.Println(foundIds)
 				createQueryParams := make([]map[string]any, 0)
 				for _, query := range batch {
-					if _, ok := foundIds[query.Params["_id"].(string)]; !ok {
+					if _, ok := foundIds[entityKey(query.Entity, query.Params)]; !ok {
 						createQueryParams = append(createQueryParams, query.Params)
-						countWriteObjects++
+						written++
 					}
 				}
 				// transform "$" in query to "param."
@@ -389,8 +648,17 @@ func executeMatchWithUnwindAndMutateInTxnBatches(driver neo4j.DriverWithContext,
 				}
 
 				return nil, nil
-			},
+			})),
 		)
+		attempts.settle(err)
+		sizer.observe(time.Since(start), attempts.attempts > 1)
+		if err == nil {
+			countReadObjects += read
+			countWriteObjects += written
+		}
+		run.observe(countReadObjects + countWriteObjects)
+		countRetries += max(attempts.attempts-1, 0)
+		countDeadlocks += attempts.deadlocks
 		if err != nil {
 			return err
 		}
@@ -398,10 +666,10 @@ func executeMatchWithUnwindAndMutateInTxnBatches(driver neo4j.DriverWithContext,
 	return nil
 }
 
-func getMatchAndCreateTxn(queries []ParamedCql) neo4j.ManagedTransactionWork {
-	return func(tx neo4j.ManagedTransaction) (any, error) {
+func getMatchAndCreateTxn(queries []ParamedCql) transactionWork {
+	return func(tx transaction) (any, error) {
 		for _, query := range queries {
-			searchQuery := fmt.Sprintf("MATCH (n:%s{`~id`: $_id}) RETURN n LIMIT 1", query.Entity)
+			searchQuery := fmt.Sprintf("MATCH (n:%s{%s}) RETURN n LIMIT 1", query.Entity, keyPattern("_id", "tenantId"))
 			result, err := tx.Run(context.Background(), searchQuery, query.Params)
 			if err != nil {
 				return nil, fmt.Errorf("failed to execute query '%s': %w", searchQuery, err)
@@ -416,3 +684,196 @@ func getMatchAndCreateTxn(queries []ParamedCql) neo4j.ManagedTransactionWork {
 		return nil, nil
 	}
 }
+
+// executeReadInTxnBatches runs the reads in txn batches and returns the objects they found
+func executeReadInTxnBatches(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64) (int, error) {
+	// Create a session
+	session := driver.NewSession(context.Background(), neo4j.SessionConfig{
+		AccessMode:   neo4j.AccessModeRead,
+		DatabaseName: currentDatabase(),
+	})
+	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries := 0, 0, 0, 0
+	run := measure(name, batchSize, contentionRatio, &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries)
+	defer run.finish()
+	defer session.Close(context.Background())
+
+	// Execute the transaction, keeping only the counts of the attempt that committed
+	for i := 0; i < len(queries); i += batchSize {
+		found := 0
+		_, err := session.ExecuteRead(context.Background(), managed(instrumented(run,
+			func(tx transaction) (any, error) {
+				batch := queries[i:min(i+batchSize, len(queries))]
+				readQueryParams := make([]map[string]any, 0)
+				for _, query := range batch {
+					readQueryParams = append(readQueryParams, query.Params)
+				}
+				// transform "$" in query to "param."
+				newQuery := "UNWIND $params AS param " + strings.ReplaceAll(queries[i].Query, "$", "param.")
+				result, err := tx.Run(context.Background(), newQuery, map[string]any{"params": readQueryParams})
+				countReadQueries++
+				if err != nil {
+					return nil, fmt.Errorf("failed to execute query '%s': %w", newQuery, err)
+				}
+				records, err := result.Collect(context.Background())
+				if err != nil {
+					return nil, fmt.Errorf("failed to collect records: %w", err)
+				}
+				found = len(records)
+
+				return nil, nil
+			})),
+		)
+		if err == nil {
+			countReadObjects += found
+		}
+		run.observe(countReadObjects + countWriteObjects)
+		if err != nil {
+			return countReadObjects, err
+		}
+	}
+	return countReadObjects, nil
+}
+
+func executeLookupInTxnBatches(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Create a session
+	session := driver.NewSession(context.Background(), neo4j.SessionConfig{
+		AccessMode:   neo4j.AccessModeRead,
+		DatabaseName: currentDatabase(),
+	})
+	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries := 0, 0, 0, 0
+	run := measure(name, batchSize, contentionRatio, &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries)
+	defer run.finish()
+	defer session.Close(context.Background())
+
+	// Execute the transaction, keeping only the counts of the attempt that committed
+	for i := 0; i < len(queries); i += batchSize {
+		found := 0
+		_, err := session.ExecuteRead(context.Background(), managed(instrumented(run,
+			func(tx transaction) (any, error) {
+				batch := queries[i:min(i+batchSize, len(queries))]
+				lookup, lookupParams := lookupEntities(batch, false)
+				searchQuery := lookup + " RETURN n.`~id` AS entityId"
+				result, err := tx.Run(context.Background(), searchQuery, lookupParams)
+				countReadQueries++
+				if err != nil {
+					return nil, fmt.Errorf("failed to execute query '%s': %w", searchQuery, err)
+				}
+				records, err := result.Collect(context.Background())
+				if err != nil {
+					return nil, fmt.Errorf("failed to collect records: %w", err)
+				}
+				found = len(records)
+
+				return nil, nil
+			})),
+		)
+		if err == nil {
+			countReadObjects += found
+		}
+		run.observe(countReadObjects + countWriteObjects)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasApoc reports whether the server has APOC installed, which the apoc.periodic.iterate experiments depend on
+func hasApoc(driver neo4j.DriverWithContext) (bool, error) {
+	result, err := neo4j.ExecuteQuery(context.Background(), driver, "SHOW PROCEDURES YIELD name WHERE name = 'apoc.periodic.iterate' RETURN count(*) > 0 AS available", nil, neo4j.EagerResultTransformer, neo4j.ExecuteQueryWithDatabase(currentDatabase()))
+	if err != nil {
+		return false, fmt.Errorf("failed to list procedures: %w", err)
+	}
+	available, _ := result.Records[0].Get("available")
+	return available.(bool), nil
+}
+
+func executeInTransactions(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Create a session
+	session := driver.NewSession(context.Background(), neo4j.SessionConfig{
+		AccessMode:   neo4j.AccessModeWrite,
+		DatabaseName: currentDatabase(),
+	})
+	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries := 0, 0, 0, 0
+	run := measure(name, batchSize, contentionRatio, &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries)
+	defer run.finish()
+	defer session.Close(context.Background())
+	if len(queries) == 0 {
+		return nil
+	}
+
+	// Push all parameters at once and let the server commit every batchSize rows, which requires an auto-commit
+	// transaction
+	createQueryParams := make([]map[string]any, 0)
+	for _, query := range queries {
+		createQueryParams = append(createQueryParams, query.Params)
+	}
+	// transform "$" in query to "param."
+	newQuery := fmt.Sprintf("UNWIND $params AS param CALL { WITH param %s } IN TRANSACTIONS OF %d ROWS", strings.ReplaceAll(queries[0].Query, "$", "param."), batchSize)
+	// Instrumented like the transactions of the other executors, with the session as the auto-commit transaction
+	_, err := instrumented(run, func(tx transaction) (any, error) {
+		_, err := tx.Run(context.Background(), newQuery, map[string]any{"params": createQueryParams})
+		countWriteQueries++
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute query '%s': %w", newQuery, err)
+		}
+		return nil, nil
+	})(autoCommitTxn{session: session})
+	if err != nil {
+		return err
+	}
+	countWriteObjects += len(queries)
+	return nil
+}
+
+func executeApocPeriodicIterate(driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64, parallel bool) error {
+	// Create a session
+	session := driver.NewSession(context.Background(), neo4j.SessionConfig{
+		AccessMode:   neo4j.AccessModeWrite,
+		DatabaseName: currentDatabase(),
+	})
+	countReadObjects, countWriteObjects, countReadQueries, countWriteQueries := 0, 0, 0, 0
+	run := measure(name, batchSize, contentionRatio, &countReadObjects, &countWriteObjects, &countReadQueries, &countWriteQueries)
+	defer run.finish()
+	defer session.Close(context.Background())
+	// APOC plans the action in transactions of its own, which an EXPLAIN of the call would not reach, so priming skips
+	// the call rather than let it write
+	if len(queries) == 0 || isPriming() {
+		return nil
+	}
+
+	// Push all parameters at once and let APOC commit every batchSize rows
+	createQueryParams := make([]map[string]any, 0)
+	for _, query := range queries {
+		createQueryParams = append(createQueryParams, query.Params)
+	}
+	// transform "$" in query to "param."
+	action := strings.ReplaceAll(queries[0].Query, "$", "param.")
+	iterateQuery := "CALL apoc.periodic.iterate('UNWIND $params AS param RETURN param', $action, {batchSize: $batchSize, parallel: $parallel, params: {params: $params}}) YIELD failedBatches, errorMessages RETURN failedBatches, errorMessages"
+	// Instrumented like the transactions of the other executors, with the session as the auto-commit transaction
+	_, err := instrumented(run, func(tx transaction) (any, error) {
+		result, err := tx.Run(context.Background(), iterateQuery, map[string]any{"action": action, "batchSize": batchSize, "parallel": parallel, "params": createQueryParams})
+		countWriteQueries++
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute query '%s': %w", action, err)
+		}
+		records, err := result.Collect(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute query '%s': %w", action, err)
+		}
+		if len(records) != 1 {
+			return nil, fmt.Errorf("failed to execute query '%s': expected a single record, got %d", action, len(records))
+		}
+		failedBatches, _ := records[0].Get("failedBatches")
+		if failedBatches.(int64) > 0 {
+			errorMessages, _ := records[0].Get("errorMessages")
+			return nil, fmt.Errorf("failed to execute query '%s': %d failed batches: %v", action, failedBatches, errorMessages)
+		}
+		return nil, nil
+	})(autoCommitTxn{session: session})
+	if err != nil {
+		return err
+	}
+	countWriteObjects += len(queries)
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	lockOrderNone       = "none"
+	lockOrderByGroup    = "by-group"
+	lockOrderByEndpoint = "by-endpoint"
+)
+
+var lockOrderings = []string{lockOrderNone, lockOrderByGroup, lockOrderByEndpoint}
+
+// lockKeys returns the ids of the nodes a query locks, in the order given by the lock ordering
+func lockKeys(query ParamedCql, ordering string) []string {
+	userId, isEdge := query.Params["user_id"].(string)
+	if !isEdge {
+		id, _ := query.Params["_id"].(string)
+		return []string{id}
+	}
+	groupId, _ := query.Params["group_id"].(string)
+	if ordering == lockOrderByEndpoint {
+		return []string{userId, groupId}
+	}
+	return []string{groupId, userId}
+}
+
+// prepareBatches reorders the queries so that concurrent batches acquire their node locks in a consistent order.
+// by-group keeps all edges of a group together, so that a batch touches as few groups as possible, while by-endpoint
+// orders edges by the user they point to.
+func prepareBatches(queries []ParamedCql, ordering string) ([]ParamedCql, error) {
+	switch ordering {
+	case lockOrderNone:
+		return queries, nil
+	case lockOrderByGroup, lockOrderByEndpoint:
+	default:
+		return nil, fmt.Errorf("unknown lock ordering '%s'", ordering)
+	}
+	prepared := make([]ParamedCql, len(queries))
+	copy(prepared, queries)
+	sort.SliceStable(prepared, func(i, j int) bool {
+		a, b := lockKeys(prepared[i], ordering), lockKeys(prepared[j], ordering)
+		for k := 0; k < min(len(a), len(b)); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return prepared, nil
+}
+
+// withLockOrdering labels a metric name with the lock ordering it was measured with, leaving unordered names as is
+func withLockOrdering(name, ordering string) string {
+	if ordering == lockOrderNone {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, ordering)
+}
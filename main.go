@@ -3,13 +3,19 @@ package main
 import (
 	"context"
 	"encoding/csv"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/montanaflynn/stats"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
@@ -20,27 +26,231 @@ const (
 var batches = []int{1, 100, 500, 1000, 5000}
 var contentionRatios = []float64{0.0, 0.01, 0.1, 0.5, 0.9, 0.99}
 
-var metrics = make(map[struct {
+// apocAvailable is set once connected, the server batching experiments using apoc.periodic.iterate only run with APOC
+var apocAvailable bool
+
+type metricKey struct {
 	name            string
 	batchSize       int
 	contentionRatio float64
-}][]struct {
+	txnMode         string
+	schema          string
+	cacheMode       string
+}
+
+type metric struct {
 	countReadObjects    int
 	countWriteObjects   int
 	countReadQueries    int
 	countWriteQueries   int
+	countRetries        int
+	countDeadlocks      int
+	position            int
+	start               time.Time
 	totalTime           time.Duration
 	effectiveThroughput float64
-})
+}
+
+type experimentFamily struct {
+	name string
+	run  func(*log.Logger, neo4j.DriverWithContext) error
+}
+
+// experimentFamilies are run in this order, each family sweeping every cell of its own experiments
+var experimentFamilies = []experimentFamily{
+	{"node", RunNodeExperiments},
+	{"edge", RunEdgeExperiments},
+	{"edge-upsert", RunEdgeUpsertExperiments},
+	{"tenant", RunTenantExperiments},
+	{"delete", RunDeleteExperiments},
+	{"read", RunReadExperiments},
+	{"workload", RunWorkloadExperiments},
+}
+
+// families are the experiment families selected to run, all of them by default
+var families = []string{"node", "edge", "edge-upsert", "tenant", "delete", "read", "workload"}
+
+var metricsMu sync.Mutex
+var metrics = make(map[metricKey][]metric)
 
 func main() {
+	flag.IntVar(&tenantCount, "tenants", tenantCount, "number of tenants the objects are spread across")
+	flag.Float64Var(&tenantSkew, "tenant-skew", tenantSkew, "zipf exponent of the tenant size distribution (0 for equally sized tenants)")
+	flag.BoolVar(&tenantScopedIds, "tenant-scoped-ids", tenantScopedIds, "make `~id` unique per tenant with composite constraints instead of globally")
+	flag.StringVar(&workloadSpec, "workload", workloadSpec, "workload to drive: a, b, c, ingest or a spec such as read=95,update=5, an operation=weight:concurrency getting workers of its own (empty to skip)")
+	flag.IntVar(&workloadConcurrency, "workload-concurrency", workloadConcurrency, "number of concurrent workload workers sharing the operations mixed by weight")
+	flag.DurationVar(&workloadDuration, "workload-duration", workloadDuration, "how long to drive the workload for (0 for no limit)")
+	flag.IntVar(&workloadOperations, "workload-operations", workloadOperations, "number of operations to issue, every object of a batch counting as one (0 for no limit)")
+	flag.Func("lock-orderings", "comma separated lock orderings the edge experiments compare: none, by-group, by-endpoint", func(value string) error {
+		lockOrderings = strings.Split(value, ",")
+		for _, ordering := range lockOrderings {
+			if _, err := prepareBatches(nil, ordering); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	flag.Func("graph-shape", "shape of the edge experiment graph: complete, bipartite, power-law, supernode or erdos-renyi", func(value string) error {
+		graphShape = value
+		return validateGraphShape(value)
+	})
+	flag.IntVar(&graphUsers, "graph-users", graphUsers, "number of users in the edge experiment graph (0 for the shape's default)")
+	flag.IntVar(&graphGroups, "graph-groups", graphGroups, "number of groups in the edge experiment graph (0 for the shape's default)")
+	flag.IntVar(&graphFanOut, "graph-fan-out", graphFanOut, "groups per user for the bipartite, power-law and supernode shapes")
+	flag.Float64Var(&graphEdgeProbability, "graph-edge-probability", graphEdgeProbability, "edge probability for the erdos-renyi shape")
+	flag.Float64Var(&graphPowerLawExponent, "graph-power-law-exponent", graphPowerLawExponent, "exponent (> 1) of the group degree distribution for the power-law shape")
+	flag.IntVar(&graphSupernodes, "graph-supernodes", graphSupernodes, "number of groups every user is bound to for the supernode shape")
+	flag.Func("txn-modes", "comma separated transaction modes the node experiments compare: managed, explicit, auto-commit", func(value string) error {
+		txnModes = strings.Split(value, ",")
+		for _, mode := range txnModes {
+			if err := validateTxnMode(mode); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	flag.Func("schema-variants", "comma separated schemas the node and edge upsert experiments compare: none, range, unique, node-key or text, each optionally followed by +rel", func(value string) error {
+		schemaVariants = strings.Split(value, ",")
+		for _, variant := range schemaVariants {
+			if err := validateSchema(variant); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	flag.Func("reset", "how to reset the graph between experiments: detach-delete, batched, replace-database (Enterprise) or throwaway (Enterprise)", func(value string) error {
+		resetStrategy = value
+		return validateResetStrategy(value)
+	})
+	flag.StringVar(&resetTimesPath, "reset-times", resetTimesPath, "write how long every reset of the graph took to this file (empty to skip)")
+	flag.Func("experiments", "comma separated experiment families to run: node, edge, edge-upsert, tenant, delete, read, workload", func(value string) error {
+		families = strings.Split(value, ",")
+		for _, name := range families {
+			if !slices.ContainsFunc(experimentFamilies, func(family experimentFamily) bool { return family.name == name }) {
+				return fmt.Errorf("unknown experiment family '%s'", name)
+			}
+		}
+		return nil
+	})
+	flag.Func("database", "database to run the experiments against (default the server default)", func(value string) error {
+		setDatabase(value)
+		return nil
+	})
+	flag.BoolVar(&isolateDatabases, "isolate-databases", isolateDatabases, "run every experiment family in a database of its own, created and dropped around it (Enterprise)")
+	flag.StringVar(&profilePath, "profile", profilePath, "profile every distinct query of every strategy once per cell, in a pass of its own, and write the plans to this file (empty to skip)")
+	// The pairs given replace the default ones rather than add to them
+	planDiffsSet := false
+	flag.Func("plan-diff", "pair of strategies to diff the plans of in the report, as name|name (repeatable, replaces the default pairs)", func(value string) error {
+		a, b, ok := strings.Cut(value, "|")
+		if !ok {
+			return fmt.Errorf("invalid plan diff '%s': expected name|name", value)
+		}
+		if !planDiffsSet {
+			planDiffs, planDiffsSet = nil, true
+		}
+		planDiffs = append(planDiffs, [2]string{a, b})
+		return nil
+	})
+	flag.StringVar(&serverMetricsPath, "server-metrics", serverMetricsPath, "sample the server state while the experiments run and write the samples to this file (empty to skip)")
+	flag.DurationVar(&serverMetricsInterval, "server-metrics-interval", serverMetricsInterval, "how often to sample the server state")
+	flag.StringVar(&prometheusURL, "prometheus-url", prometheusURL, "Prometheus endpoint of the server to scrape, such as http://localhost:2004/metrics (empty to skip)")
+	flag.Func("prometheus-metrics", "regular expression selecting the scraped Prometheus metrics to keep", func(value string) error {
+		pattern, err := regexp.Compile(value)
+		prometheusMetrics = pattern
+		return err
+	})
+	flag.IntVar(&warmupRuns, "warmup-runs", warmupRuns, "runs of every cell executed before the measured ones and discarded")
+	flag.BoolVar(&primePlans, "prime-plans", primePlans, "plan every generated query of a cell with EXPLAIN before its runs, priming the query plan cache")
+	flag.Func("cache-modes", "comma separated cache modes to measure every cell in: warm, or cold to clear the query caches before every experiment", func(value string) error {
+		cacheModes = strings.Split(value, ",")
+		for _, mode := range cacheModes {
+			if err := validateCacheMode(mode); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	flag.Func("ordering", "order to run the node experiments in: fixed, shuffled (every run), latin-square or interleaved (across cells)", func(value string) error {
+		orderingPolicy = value
+		return validateOrderingPolicy(value)
+	})
+	flag.Float64Var(&ciWidth, "ci-width", ciWidth, "keep running a cell until the 95% confidence interval of every mean total time is narrower than this fraction of the mean (0 to always stop at the fixed runs)")
+	flag.IntVar(&maxRuns, "max-runs", maxRuns, "most runs of a cell when running until the confidence interval is narrow enough")
+	flag.Float64Var(&maxCV, "max-cv", maxCV, "rerun a cell whose total times have a coefficient of variation above this (0 to never rerun)")
+	flag.IntVar(&cellReruns, "reruns", cellReruns, "most times to rerun an unstable cell")
+	flag.Func("outliers", "how to flag outlying total times in the results: mad or iqr", func(value string) error {
+		outliers = value
+		return validateOutliers(value)
+	})
+	flag.Func("progress", "how to report the progress of the sweep: auto (live status when stdout is a terminal), tty or log", func(value string) error {
+		progressMode = value
+		return validateProgressMode(value)
+	})
+	outputFile := flag.String("output", "results.csv", "file to write the results to")
+	backgroundReads := flag.Bool("background-reads", false, "look up random users throughout the write experiments")
+	flag.BoolVar(&adaptiveBatching, "adaptive-batching", adaptiveBatching, "also run every txn batch node experiment with batch sizes adapted AIMD-style to the transaction latency")
+	flag.DurationVar(&adaptiveTargetLatency, "adaptive-target-latency", adaptiveTargetLatency, "transaction latency the adaptive batch sizes grow below and shrink above")
+	flag.IntVar(&adaptiveIncrease, "adaptive-increase", adaptiveIncrease, "rows (>= 1) the adaptive batch size grows by after a fast transaction")
+	flag.Float64Var(&adaptiveDecrease, "adaptive-decrease", adaptiveDecrease, "factor (between 0 and 1) the adaptive batch size shrinks by after a slow or retried transaction")
+	flag.IntVar(&adaptiveMaxBatch, "adaptive-max-batch", adaptiveMaxBatch, "largest adaptive batch size (>= 1)")
+	flag.StringVar(&timelinePath, "timeline", timelinePath, "sample the objects every executor has read and written over time and write the timelines to this file (empty to skip)")
+	flag.DurationVar(&timelineInterval, "timeline-interval", timelineInterval, "how often to sample the objects of an executor (> 0)")
+	flag.StringVar(&metricsListen, "metrics-listen", metricsListen, "address to serve live Prometheus metrics of the sweep on, such as :9464 (empty to skip)")
+	flag.StringVar(&traceEndpoint, "trace-endpoint", traceEndpoint, "OTLP/HTTP endpoint of a collector to export spans of the experiments, transactions and queries to, such as http://localhost:4318 (empty to skip)")
+	flag.StringVar(&tracePath, "trace", tracePath, "path to write spans of the experiments, transactions and queries to as OTLP JSON (empty to skip)")
+	flag.Func("tune-strategy", "strategy the tune command searches the batch size of, such as txn batch merge", func(value string) error {
+		tuneStrategy = value
+		return validateTuneStrategy(value)
+	})
+	flag.Float64Var(&tuneContentionRatio, "tune-contention-ratio", tuneContentionRatio, "contention ratio the tune command searches the batch size at")
+	flag.IntVar(&tuneMinBatch, "tune-min-batch", tuneMinBatch, "smallest batch size (>= 1) the tune command considers")
+	flag.IntVar(&tuneMaxBatch, "tune-max-batch", tuneMaxBatch, "largest batch size the tune command considers, above the smallest")
+	flag.IntVar(&tuneRuns, "tune-runs", tuneRuns, "runs of every batch size the tune command evaluates")
+	flag.IntVar(&tuneEvaluations, "tune-evaluations", tuneEvaluations, "most batch sizes (>= 2) the tune command evaluates")
+
+	flag.Func("predict", "comma separated batch:contention settings the analyze command predicts the throughput at", func(value string) error {
+		for _, setting := range strings.Split(value, ",") {
+			prediction, err := parsePrediction(setting)
+			if err != nil {
+				return err
+			}
+			predictions = append(predictions, prediction)
+		}
+		return nil
+	})
+
+	// glatency tune searches the best batch size of a single strategy instead of running the experiments, glatency
+	// analyze [results file] fits throughput models to earlier results without connecting at all
+	command, args := "run", os.Args[1:]
+	if len(args) > 0 && (args[0] == "tune" || args[0] == "analyze") {
+		command, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	// Flags bounded by other flags or by more than a single value are validated once all are parsed
+	for _, validate := range []func() error{validateAdaptiveBatching, validateGraphParameters, validateGraphExponent, validateTimelineInterval, validateTune} {
+		if err := validate(); err != nil {
+			log.Fatalf("Invalid flags: %v", err)
+		}
+	}
+	initTenants()
+
+	if command == "analyze" {
+		path := "results.csv"
+		if flag.NArg() > 0 {
+			path = flag.Arg(0)
+		}
+		if err := RunAnalysis(log.New(logOutput, "", 0), path); err != nil {
+			log.Fatalf("Failed to analyze results: %v", err)
+		}
+		return
+	}
+
 	// Neo4j connection parameters
 	uri := "neo4j://localhost:7687"
 	username := "neo4j"
 	password := "admin@123"
 
-	outputFile := "results.csv"
-	reportFile, err := os.Create(outputFile)
+	reportFile, err := os.Create(*outputFile)
 	if err != nil {
 		log.Fatalf("Failed to create report file: %v", err)
 	}
@@ -56,61 +266,229 @@ func main() {
 	}
 	defer driver.Close(context.Background())
 
-	// Clear the graph
-	if err := executeTxn(driver, "cleanup", 0, 0.0, cleanUpGraphTxn(), true); err != nil {
-		log.Fatalf("Failed to clean up graph: %v", err)
+	// Clear the graph, unless every family gets a fresh database of its own
+	startDatabase := currentDatabase()
+	if !isolateDatabases {
+		if err := resetGraph(driver); err != nil {
+			log.Fatalf("Failed to clean up graph: %v", err)
+		}
+
+		// Create a constraint on the User, Group nodes and USER_GROUP relationship
+		if err := applySchema(driver, defaultSchema); err != nil {
+			log.Fatalf("Failed to create constraint: %v", err)
+		}
+	}
+
+	// Check for APOC
+	apocAvailable, err = hasApoc(driver)
+	if err != nil {
+		log.Fatalf("Failed to check for APOC: %v", err)
+	}
+	log.Printf("APOC available: %t", apocAvailable)
+
+	// Record what the results are produced with
+	environment = captureEnvironment(driver)
+	for _, pair := range environment {
+		log.Printf("%s: %s", pair[0], pair[1])
 	}
 
-	// Create a constraint on the User, Group nodes and USER_GROUP relationship
-	if err := executeTxn(driver, "constraint", 0, 0.0, getConstraintTxn(), true); err != nil {
-		log.Fatalf("Failed to create constraint: %v", err)
+	// Serve live metrics for as long as the sweep runs
+	if metricsListen != "" {
+		go func() {
+			if err := servePrometheusEndpoint(); err != nil {
+				log.Printf("Failed to serve metrics: %v", err)
+			}
+		}()
 	}
 
 	// Run the experiments
-	RunNodeExperiments(log.New(os.Stdout, "", 0), driver)
-	RunEdgeExperiments(log.New(os.Stdout, "", 0), driver)
-
-	// Print the metrics
-	header := []string{"Name", "Batch Size", "Contention Ratio", "Total Time", "Effective Throughput"}
-	if err := report.Write(header); err != nil {
-		log.Fatalf("error writing record to csv: %v", err)
-	}
-	for key, metric := range metrics {
-		totalTimeSlice := []float64{}
-		effectiveThroughputSlice := []float64{}
-		for _, m := range metric {
-			record := []string{
-				key.name,
-				fmt.Sprintf("%d", key.batchSize),
-				fmt.Sprintf("%.2f", key.contentionRatio),
-				fmt.Sprintf("%d", m.totalTime.Milliseconds()),
-				fmt.Sprintf("%.2f", m.effectiveThroughput),
+	if command == "run" {
+		startProgress(families)
+	}
+	ctx, stopBackground := context.WithCancel(context.Background())
+	g := new(errgroup.Group)
+	if *backgroundReads {
+		g.Go(func() error {
+			return RunBackgroundReads(ctx, log.New(logOutput, "", 0), driver)
+		})
+	}
+	if serverMetricsPath != "" {
+		g.Go(func() error {
+			return RunServerMetricsSampler(ctx, log.New(logOutput, "", 0), driver)
+		})
+	}
+	var curve map[int]float64
+	if command == "tune" {
+		curve = RunTune(log.New(logOutput, "", 0), driver)
+	} else {
+		for _, family := range experimentFamilies {
+			if !slices.Contains(families, family.name) {
+				continue
 			}
-			if err := report.Write(record); err != nil {
-				log.Fatalf("error writing record to csv: %v", err)
+			startExperimentSpan(family.name)
+			startProgressFamily(family.name)
+			if !isolateDatabases {
+				if err := family.run(log.New(logOutput, "", 0), driver); err != nil {
+					log.Fatalf("Failed to run %s experiments: %v", family.name, err)
+				}
+			} else if err := runIsolated(log.New(logOutput, "", 0), driver, family.name, family.run); err != nil {
+				log.Fatalf("Failed to run %s experiments in their own database: %v", family.name, err)
 			}
-			totalTimeSlice = append(totalTimeSlice, float64(m.totalTime.Milliseconds()))
-			effectiveThroughputSlice = append(effectiveThroughputSlice, m.effectiveThroughput)
+			finishExperimentSpan()
 		}
-		totalTimeMedian, err := stats.Median(totalTimeSlice)
-		if err != nil {
-			log.Fatalf("Failed to calculate median of total time: %v", err)
+	}
+	stopBackground()
+	if err := g.Wait(); err != nil {
+		log.Fatalf("Failed to execute background work: %v", err)
+	}
+	// A throwaway reset leaves the sweep in a database of its own
+	if err := restoreDatabase(driver, startDatabase); err != nil {
+		log.Fatalf("Failed to drop the throwaway database: %v", err)
+	}
+	stopProgress()
+	if err := flushTraces(); err != nil {
+		log.Fatalf("Failed to export traces: %v", err)
+	}
+
+	// The tune command writes the curve it explored, the measurements being what the curve is made of
+	if command == "tune" {
+		if err := writeTuneCurve(reportFile, curve); err != nil {
+			log.Fatalf("Failed to store tune curve: %v", err)
+		}
+	} else {
+		// Print the metrics, with the environment they were measured in alongside
+		if err := writeEnvironment(*outputFile); err != nil {
+			log.Fatalf("error writing environment: %v", err)
 		}
-		effectiveWriteThroughputMedian, err := stats.Median(effectiveThroughputSlice)
-		if err != nil {
-			log.Fatalf("Failed to calculate median of effective write throughput: %v", err)
+		header := []string{"Name", "Batch Size", "Contention Ratio", "Txn Mode", "Schema", "Cache", "Position", "Total Time", "Effective Throughput", "Retries", "Deadlocks", "Outlier", "Traced"}
+		if err := report.Write(header); err != nil {
+			log.Fatalf("error writing record to csv: %v", err)
 		}
-		log.Printf("%s:\t batch size %d\t contention ratio %.2f\t total time median %.2f\t effective write throughput median %.2f\t",
-			key.name, key.batchSize, key.contentionRatio, totalTimeMedian, effectiveWriteThroughputMedian,
-		)
+		for key, metric := range metrics {
+			totalTimeSlice := []float64{}
+			effectiveThroughputSlice := []float64{}
+			retriesSlice := []float64{}
+			totalTimes := make([]float64, 0, len(metric))
+			for _, m := range metric {
+				totalTimes = append(totalTimes, float64(m.totalTime.Microseconds()))
+			}
+			outlierFlags := flagOutliers(totalTimes)
+			countOutliers := 0
+			for i, m := range metric {
+				record := []string{
+					key.name,
+					fmt.Sprintf("%d", key.batchSize),
+					fmt.Sprintf("%.2f", key.contentionRatio),
+					key.txnMode,
+					key.schema,
+					key.cacheMode,
+					fmt.Sprintf("%d", m.position),
+					fmt.Sprintf("%d", m.totalTime.Milliseconds()),
+					fmt.Sprintf("%.2f", m.effectiveThroughput),
+					fmt.Sprintf("%d", m.countRetries),
+					fmt.Sprintf("%d", m.countDeadlocks),
+					fmt.Sprintf("%t", outlierFlags[i]),
+					// Tracing buffers the records of every query, which adds to the total time
+					fmt.Sprintf("%t", tracing()),
+				}
+				if outlierFlags[i] {
+					countOutliers++
+				}
+				if err := report.Write(record); err != nil {
+					log.Fatalf("error writing record to csv: %v", err)
+				}
+				totalTimeSlice = append(totalTimeSlice, float64(m.totalTime.Milliseconds()))
+				effectiveThroughputSlice = append(effectiveThroughputSlice, m.effectiveThroughput)
+				retriesSlice = append(retriesSlice, float64(m.countRetries))
+			}
+			totalTimeMedian, err := stats.Median(totalTimeSlice)
+			if err != nil {
+				log.Fatalf("Failed to calculate median of total time: %v", err)
+			}
+			effectiveWriteThroughputMedian, err := stats.Median(effectiveThroughputSlice)
+			if err != nil {
+				log.Fatalf("Failed to calculate median of effective write throughput: %v", err)
+			}
+			retriesMedian, err := stats.Median(retriesSlice)
+			if err != nil {
+				log.Fatalf("Failed to calculate median of retries: %v", err)
+			}
+			log.Printf("%s:\t batch size %d\t contention ratio %.2f\t txn mode %s\t schema %s\t cache %s\t total time median %.2f\t effective write throughput median %.2f\t retries median %.1f\t outliers %d\t",
+				key.name, key.batchSize, key.contentionRatio, key.txnMode, key.schema, key.cacheMode, totalTimeMedian, effectiveWriteThroughputMedian, retriesMedian, countOutliers,
+			)
 
+		}
+	}
+	reportReadDegradation()
+	reportResetTimes()
+	if resetTimesPath != "" {
+		if err := writeResetTimes(); err != nil {
+			log.Fatalf("Failed to store reset times: %v", err)
+		}
+	}
+	if timelinePath != "" {
+		if err := writeTimelines(); err != nil {
+			log.Fatalf("Failed to store timelines: %v", err)
+		}
+		reportDegradationOverTime()
+	}
+	if profilePath != "" {
+		if err := writeProfiles(); err != nil {
+			log.Fatalf("Failed to store query plans: %v", err)
+		}
+		reportPlanDiffs()
+	}
+	if serverMetricsPath != "" {
+		if err := writeServerMetrics(); err != nil {
+			log.Fatalf("Failed to store server metrics: %v", err)
+		}
 	}
 
 	log.Print("Successfully executed all queries.")
 }
 
+// execution is the measured run of a strategy by an executor, with the timeline it publishes its counts on and the
+// span its transactions are traced under
+type execution struct {
+	*timeline
+	name            string
+	batchSize       int
+	contentionRatio float64
+	start           time.Time
+	span            *span
+	finish          func()
+}
+
+// measure starts measuring an executor, which defers finish to record the measurement along with its timeline and
+// span once it is done
+func measure(name string, batchSize int, contentionRatio float64, countReadObjects, countWriteObjects, countReadQueries, countWriteQueries *int) *execution {
+	return measureWithRetries(name, batchSize, contentionRatio, countReadObjects, countWriteObjects, countReadQueries, countWriteQueries, nil, nil)
+}
+
+// measureWithRetries is measure for executors that also count their retries and deadlocks
+func measureWithRetries(name string, batchSize int, contentionRatio float64, countReadObjects, countWriteObjects, countReadQueries, countWriteQueries, countRetries, countDeadlocks *int) *execution {
+	run := &execution{timeline: startTimeline(), name: name, batchSize: batchSize, contentionRatio: contentionRatio, start: time.Now(), span: startRunSpan(name)}
+	run.finish = func() {
+		run.record(name, batchSize, contentionRatio, *countReadObjects+*countWriteObjects)
+		recordLatency(run.span, name, batchSize, contentionRatio, run.start, countReadObjects, countWriteObjects, countReadQueries, countWriteQueries, countRetries, countDeadlocks)
+	}
+	return run
+}
+
 // latency measures the time taken to execute the queries and can be punched in as defer statement to any function
 func latency(name string, batchSize int, contentionRatio float64, start time.Time, countReadObjects, countWriteObjects, countReadQueries, countWriteQueries *int) {
+	latencyWithRetries(name, batchSize, contentionRatio, start, countReadObjects, countWriteObjects, countReadQueries, countWriteQueries, nil, nil)
+}
+
+// latencyWithRetries is latency for executors that also count how often their transactions were retried and how many
+// of the failed attempts were deadlocks
+func latencyWithRetries(name string, batchSize int, contentionRatio float64, start time.Time, countReadObjects, countWriteObjects, countReadQueries, countWriteQueries, countRetries, countDeadlocks *int) {
+	recordLatency(nil, name, batchSize, contentionRatio, start, countReadObjects, countWriteObjects, countReadQueries, countWriteQueries, countRetries, countDeadlocks)
+}
+
+// recordLatency records a measurement and finishes the span of its run, which measurements spanning several executors
+// do not have and get one of their own
+func recordLatency(run *span, name string, batchSize int, contentionRatio float64, start time.Time, countReadObjects, countWriteObjects, countReadQueries, countWriteQueries, countRetries, countDeadlocks *int) {
 	elapsed := time.Since(start)
 	if countReadObjects == nil {
 		countReadObjects = new(int)
@@ -124,62 +502,97 @@ func latency(name string, batchSize int, contentionRatio float64, start time.Tim
 	if countWriteQueries == nil {
 		countWriteQueries = new(int)
 	}
-	log.Printf("%s: total time %s\t read objects: %d\t write objects: %d\t read queries: %d\t write queries: %d\t effective write throughput: %.2f\t",
-		name, elapsed, *countReadObjects, *countWriteObjects, *countReadQueries, *countWriteQueries, float64(*countWriteObjects)/elapsed.Seconds(),
+	if countRetries == nil {
+		countRetries = new(int)
+	}
+	if countDeadlocks == nil {
+		countDeadlocks = new(int)
+	}
+	log.Printf("%s: total time %s\t read objects: %d\t write objects: %d\t read queries: %d\t write queries: %d\t retries: %d\t deadlocks: %d\t effective write throughput: %.2f\t",
+		name, elapsed, *countReadObjects, *countWriteObjects, *countReadQueries, *countWriteQueries, *countRetries, *countDeadlocks, float64(*countWriteObjects)/elapsed.Seconds(),
 	)
-	key := struct {
-		name            string
-		batchSize       int
-		contentionRatio float64
-	}{
-		name:            name,
-		batchSize:       batchSize,
-		contentionRatio: contentionRatio,
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	finishRunSpan(run, name, start, map[string]any{
+		"glatency.batch_size":       batchSize,
+		"glatency.contention_ratio": contentionRatio,
+		"glatency.txn_mode":         txnMode,
+		"glatency.schema":           schema,
+		"glatency.cache":            cacheMode,
+		"glatency.read_objects":     *countReadObjects,
+		"glatency.write_objects":    *countWriteObjects,
+		"glatency.read_queries":     *countReadQueries,
+		"glatency.write_queries":    *countWriteQueries,
+		"glatency.retries":          *countRetries,
+		"glatency.deadlocks":        *countDeadlocks,
+		"glatency.discarded":        discardMetrics,
+	})
+	if discardMetrics {
+		return
 	}
-	if _, ok := metrics[key]; !ok {
-		metrics[key] = make([]struct {
-			countReadObjects    int
-			countWriteObjects   int
-			countReadQueries    int
-			countWriteQueries   int
-			totalTime           time.Duration
-			effectiveThroughput float64
-		}, 0)
-	}
-	metrics[key] = append(metrics[key], struct {
-		countReadObjects    int
-		countWriteObjects   int
-		countReadQueries    int
-		countWriteQueries   int
-		totalTime           time.Duration
-		effectiveThroughput float64
-	}{
+	key := metricKeyOf(name, batchSize, contentionRatio)
+	m := metric{
 		countReadObjects:    *countReadObjects,
 		countWriteObjects:   *countWriteObjects,
 		countReadQueries:    *countReadQueries,
 		countWriteQueries:   *countWriteQueries,
+		countRetries:        *countRetries,
+		countDeadlocks:      *countDeadlocks,
+		position:            measurementPosition(),
+		start:               start,
 		totalTime:           elapsed,
 		effectiveThroughput: float64(*countReadObjects+*countWriteObjects) / elapsed.Seconds(),
-	})
+	}
+	observeLive(key, m)
+	measuredProgress(name, m.effectiveThroughput)
+	metrics[key] = append(metrics[key], m)
+}
+
+// metricKeyOf labels a measurement with the dimensions of the current cell, with the metrics lock held
+func metricKeyOf(name string, batchSize int, contentionRatio float64) metricKey {
+	return metricKey{
+		name:            name,
+		batchSize:       batchSize,
+		contentionRatio: contentionRatio,
+		txnMode:         txnMode,
+		schema:          schema,
+		cacheMode:       cacheMode,
+	}
 }
 
 func getUserParams(id int) map[string]any {
 	return map[string]any{
-		"_id":       fmt.Sprintf("user-%d", id),
-		"id":        fmt.Sprintf("user-%d", id),
+		"_id":       fmt.Sprintf("user-%d", idOf(id)),
+		"id":        fmt.Sprintf("user-%d", idOf(id)),
 		"email":     fmt.Sprintf("user-%d@gmail.com", id),
 		"name":      fmt.Sprintf("User-%d", id),
-		"tenantId":  "tenant-X",
+		"tenantId":  tenantOf(id),
 		"updatedAt": time.Now().Unix(),
 	}
 }
 
 func getGroupParams(id int) map[string]any {
 	return map[string]any{
-		"_id":       fmt.Sprintf("group-%d", id),
-		"id":        fmt.Sprintf("group-%d", id),
+		"_id":       fmt.Sprintf("group-%d", idOf(id)),
+		"id":        fmt.Sprintf("group-%d", idOf(id)),
 		"name":      fmt.Sprintf("Group-%d", id),
-		"tenantId":  "tenant-X",
+		"tenantId":  tenantOf(id),
 		"updatedAt": time.Now().Unix(),
 	}
 }
+
+// getEdgeParams returns the parameters of the edge between the user and the group, whose `~id` is qualified by the
+// tenants of both when ids are only unique within a tenant
+func getEdgeParams(userId, groupId int) map[string]any {
+	id := fmt.Sprintf("user-%d.group-%d", idOf(userId), idOf(groupId))
+	if tenantScopedIds {
+		id = fmt.Sprintf("%s/user-%d.%s/group-%d", tenantOf(userId), idOf(userId), tenantOf(groupId), idOf(groupId))
+	}
+	return map[string]any{
+		"_id":          id,
+		"user_id":      fmt.Sprintf("user-%d", idOf(userId)),
+		"group_id":     fmt.Sprintf("group-%d", idOf(groupId)),
+		"user_tenant":  tenantOf(userId),
+		"group_tenant": tenantOf(groupId),
+	}
+}
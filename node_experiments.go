@@ -1,64 +1,195 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"strings"
 
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 )
 
-func RunNodeExperiments(log *log.Logger, driver neo4j.DriverWithContext) {
+func RunNodeExperiments(log *log.Logger, driver neo4j.DriverWithContext) error {
 	log.Print("running experiments")
-	for _, batchSize := range batches {
-		log.Printf("batch size: %d", batchSize)
-		for _, contentionRatio := range contentionRatios {
-			log.Printf("contention ratio: %.2f", contentionRatio)
-			for run := 0; run < runs; run++ {
-				log.Printf("run: %d", run+1)
-				// Create test sets
-
-				preCreatedObjects := int(contentionRatio * totalObjects)
-
-				random := generateUniqueRandomNumbers(0, totalObjects, preCreatedObjects)
-				queriesCreatePartial := make([]ParamedCql, 0)
-				for _, i := range random {
-					params := getUserParams(i)
-					queriesCreatePartial = append(queriesCreatePartial, ParamedCql{
-						Query:  "CREATE (n:User{`~id`: $_id}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
-						Params: params,
-					})
-				}
-				queriesMerge := make([]ParamedCql, 0)
-				for i := 0; i < totalObjects; i++ {
-					params := getUserParams(i)
-					queriesMerge = append(queriesMerge, ParamedCql{
-						Query:  "MERGE (n:User{`~id`: $_id}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
-						Entity: "User",
-						Params: params,
-					})
+	if orderingPolicy == orderInterleaved {
+		cells := make([]nodeCell, 0)
+		for _, batchSize := range batches {
+			for _, contentionRatio := range contentionRatios {
+				for _, variant := range schemaVariants {
+					cells = append(cells, nodeCell{batchSize: batchSize, contentionRatio: contentionRatio, schema: variant})
 				}
-				queriesCreate := make([]ParamedCql, 0)
-				for i := 0; i < totalObjects; i++ {
-					params := getUserParams(i)
-					queriesCreate = append(queriesCreate, ParamedCql{
-						Query:  "CREATE (n:User{`~id`: $_id}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
-						Entity: "User",
-						Params: params,
+			}
+		}
+		err := forEachInterleavedRun(log, driver, len(cells), func(i int) error {
+			cell := cells[i]
+			enterCell(cell.batchSize, cell.contentionRatio)
+			log.Printf("batch size: %d\t contention ratio: %.2f\t schema: %s", cell.batchSize, cell.contentionRatio, cell.schema)
+			if err := ensureSchema(driver, cell.schema); err != nil {
+				return fmt.Errorf("failed to apply schema: %w", err)
+			}
+			return runNodeExperiments(log, driver, cell.batchSize, cell.contentionRatio)
+		}, func(i int) {
+			finishCell(cells[i].batchSize, cells[i].contentionRatio)
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, batchSize := range batches {
+			log.Printf("batch size: %d", batchSize)
+			for _, contentionRatio := range contentionRatios {
+				log.Printf("contention ratio: %.2f", contentionRatio)
+				for _, variant := range schemaVariants {
+					log.Printf("schema: %s", variant)
+					if err := applySchema(driver, variant); err != nil {
+						return fmt.Errorf("failed to apply schema: %w", err)
+					}
+					err := forEachRun(log, driver, batchSize, contentionRatio, func() error {
+						return runNodeExperiments(log, driver, batchSize, contentionRatio)
 					})
+					if err != nil {
+						return err
+					}
 				}
-
-				ExperimentMerge(driver, queriesCreatePartial, queriesMerge, contentionRatio)
-				ExperimentBatchedMerge(driver, queriesCreatePartial, queriesMerge, batchSize, contentionRatio)
-				ExperimentBatchedMatchInTxnBatches(driver, queriesCreatePartial, queriesCreate, queriesMerge, batchSize, contentionRatio)
-				ExperimentBatchedMatchAndCreate(driver, queriesCreatePartial, queriesCreate, batchSize, preCreatedObjects, contentionRatio)
-				ExperimentBatchedMatchAndBatchedMerge(driver, queriesCreatePartial, queriesMerge, batchSize, preCreatedObjects, contentionRatio)
-				ExperimentBatchedMatchAndBatchedMergeWithUnwind(driver, queriesCreatePartial, queriesMerge, batchSize, preCreatedObjects, contentionRatio)
-				ExperimentBatchedMatchAndBatchedCreate(driver, queriesCreatePartial, queriesCreate, batchSize, preCreatedObjects, contentionRatio)
-				ExperimentBatchedMatchAndBatchedCreateWithUnwind(driver, queriesCreatePartial, queriesCreate, batchSize, preCreatedObjects, contentionRatio)
-				ExperimentBatchedMatchAndBatchedMergeInTxnBatches(driver, queriesCreatePartial, queriesMerge, batchSize, contentionRatio)
-				ExperimentBatchedMatchAndBatchedMergeWithUnwindInTxnBatches(driver, queriesCreatePartial, queriesMerge, batchSize, contentionRatio)
-				ExperimentBatchedMatchAndBatchedCreateInTxnBatches(driver, queriesCreatePartial, queriesCreate, batchSize, contentionRatio)
-				ExperimentBatchedMatchAndBatchedCreateWithUnwindInTxnBatches(driver, queriesCreatePartial, queriesCreate, batchSize, contentionRatio)
 			}
 		}
 	}
+	// Restore the schema the other experiments expect
+	if err := applySchema(driver, defaultSchema); err != nil {
+		return fmt.Errorf("failed to apply schema: %w", err)
+	}
+	return nil
+}
+
+type nodeCell struct {
+	batchSize       int
+	contentionRatio float64
+	schema          string
+}
+
+// orderedExperiment is one experiment of a run, along with the transaction mode it is run in
+type orderedExperiment struct {
+	name    string
+	txnMode string
+	run     func() error
+}
+
+// runNodeExperiments runs every node experiment once, in every transaction mode, in the order of the ordering policy
+func runNodeExperiments(log *log.Logger, driver neo4j.DriverWithContext, batchSize int, contentionRatio float64) error {
+	queriesCreatePartial, queriesMerge, queriesCreate, preCreatedObjects := nodeQueries(contentionRatio)
+
+	experiments := make([]orderedExperiment, 0)
+	adaptiveExperiments := make([]orderedExperiment, 0)
+	mode := ""
+	add := func(name string, run func() error) {
+		experiments = append(experiments, orderedExperiment{name: name, txnMode: mode, run: run})
+	}
+	// The adaptive runs of the txn batch experiments start from the batch size of the cell, and follow the fixed ones
+	addTxnBatch := func(name string, run func(adaptive bool) error) {
+		add(name, func() error { return run(false) })
+		if adaptiveBatching {
+			adaptiveExperiments = append(adaptiveExperiments, orderedExperiment{name: name + " (adaptive)", txnMode: mode, run: func() error { return run(true) }})
+		}
+	}
+	for _, mode = range txnModes {
+		add(mode+" merge", func() error { return ExperimentMerge(driver, queriesCreatePartial, queriesMerge, contentionRatio) })
+		add(mode+" batch merge", func() error {
+			return ExperimentBatchedMerge(driver, queriesCreatePartial, queriesMerge, batchSize, contentionRatio)
+		})
+		addTxnBatch(mode+" txn batch merge", func(adaptive bool) error {
+			return ExperimentBatchedMatchInTxnBatches(driver, queriesCreatePartial, queriesCreate, queriesMerge, batchSize, contentionRatio, adaptive)
+		})
+		add(mode+" match>create", func() error {
+			return ExperimentBatchedMatchAndCreate(driver, queriesCreatePartial, queriesCreate, batchSize, preCreatedObjects, contentionRatio)
+		})
+		add(mode+" batch match>merge", func() error {
+			return ExperimentBatchedMatchAndBatchedMerge(driver, queriesCreatePartial, queriesMerge, batchSize, preCreatedObjects, contentionRatio)
+		})
+		add(mode+" batch match+>merge", func() error {
+			return ExperimentBatchedMatchAndBatchedMergeWithUnwind(driver, queriesCreatePartial, queriesMerge, batchSize, preCreatedObjects, contentionRatio)
+		})
+		add(mode+" batch match>create", func() error {
+			return ExperimentBatchedMatchAndBatchedCreate(driver, queriesCreatePartial, queriesCreate, batchSize, preCreatedObjects, contentionRatio)
+		})
+		add(mode+" batch match+>create", func() error {
+			return ExperimentBatchedMatchAndBatchedCreateWithUnwind(driver, queriesCreatePartial, queriesCreate, batchSize, preCreatedObjects, contentionRatio)
+		})
+		addTxnBatch(mode+" txn batch match>merge", func(adaptive bool) error {
+			return ExperimentBatchedMatchAndBatchedMergeInTxnBatches(driver, queriesCreatePartial, queriesMerge, batchSize, contentionRatio, adaptive)
+		})
+		addTxnBatch(mode+" txn batch match+>merge", func(adaptive bool) error {
+			return ExperimentBatchedMatchAndBatchedMergeWithUnwindInTxnBatches(driver, queriesCreatePartial, queriesMerge, batchSize, contentionRatio, adaptive)
+		})
+		addTxnBatch(mode+" txn batch match>create", func(adaptive bool) error {
+			return ExperimentBatchedMatchAndBatchedCreateInTxnBatches(driver, queriesCreatePartial, queriesCreate, batchSize, contentionRatio, adaptive)
+		})
+		addTxnBatch(mode+" txn batch match+>create", func(adaptive bool) error {
+			return ExperimentBatchedMatchAndBatchedCreateWithUnwindInTxnBatches(driver, queriesCreatePartial, queriesCreate, batchSize, contentionRatio, adaptive)
+		})
+	}
+	experiments = append(experiments, adaptiveExperiments...)
+	// The server batching experiments always push their work in a single auto-commit transaction
+	mode = txnModeAutoCommit
+	add("server batch merge", func() error {
+		return ExperimentBatchedMergeInTransactions(driver, queriesCreatePartial, queriesMerge, batchSize, contentionRatio)
+	})
+	if apocAvailable {
+		add("apoc batch merge", func() error {
+			return ExperimentBatchedMergeWithPeriodicIterate(driver, queriesCreatePartial, queriesMerge, batchSize, contentionRatio, false)
+		})
+		add("apoc parallel batch merge", func() error {
+			return ExperimentBatchedMergeWithPeriodicIterate(driver, queriesCreatePartial, queriesMerge, batchSize, contentionRatio, true)
+		})
+	}
+
+	order := experimentOrder(len(experiments), cellRun())
+	names := make([]string, 0, len(order))
+	for _, i := range order {
+		names = append(names, experiments[i].name)
+	}
+	log.Printf("order: %s", strings.Join(names, ", "))
+	for p, i := range order {
+		setTxnMode(experiments[i].txnMode)
+		setPosition(p)
+		if err := experiments[i].run(); err != nil {
+			return err
+		}
+	}
+	setPosition(-1)
+	setTxnMode(txnModeManaged)
+	return nil
+}
+
+// nodeQueries creates the test sets of the node experiments: the users created up front to the contention ratio, and
+// the MERGE and CREATE queries for all users
+func nodeQueries(contentionRatio float64) (queriesCreatePartial, queriesMerge, queriesCreate []ParamedCql, preCreatedObjects int) {
+	preCreatedObjects = int(contentionRatio * totalObjects)
+
+	random := generateUniqueRandomNumbers(0, totalObjects, preCreatedObjects)
+	queriesCreatePartial = make([]ParamedCql, 0)
+	for _, i := range random {
+		params := getUserParams(i)
+		queriesCreatePartial = append(queriesCreatePartial, ParamedCql{
+			Query:  "CREATE (n:User{" + keyPattern("_id", "tenantId") + "}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+			Params: params,
+		})
+	}
+	queriesMerge = make([]ParamedCql, 0)
+	for i := 0; i < totalObjects; i++ {
+		params := getUserParams(i)
+		queriesMerge = append(queriesMerge, ParamedCql{
+			Query:  "MERGE (n:User{" + keyPattern("_id", "tenantId") + "}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+			Entity: "User",
+			Params: params,
+		})
+	}
+	queriesCreate = make([]ParamedCql, 0)
+	for i := 0; i < totalObjects; i++ {
+		params := getUserParams(i)
+		queriesCreate = append(queriesCreate, ParamedCql{
+			Query:  "CREATE (n:User{" + keyPattern("_id", "tenantId") + "}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+			Entity: "User",
+			Params: params,
+		})
+	}
+	return queriesCreatePartial, queriesMerge, queriesCreate, preCreatedObjects
 }
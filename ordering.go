@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+const (
+	orderFixed       = "fixed"
+	orderShuffled    = "shuffled"
+	orderLatinSquare = "latin-square"
+	orderInterleaved = "interleaved"
+)
+
+// orderingPolicy decides the order the node experiments run in within a run, and for interleaved also the order of
+// the cells: rather than every run of a cell in a row, every run visits all cells in a shuffled order
+var orderingPolicy = orderFixed
+
+// position is the place of the running experiment in the order of its run, labelling the measurements so that a bias
+// towards a place can be detected. It is -1 for the experiments that are not ordered, whose measurements are labelled
+// with the place they were taken at in their run instead.
+var position = -1
+
+// measuredRun is the index of the measured run of the cell, from 0 in every cache mode and rerun, and runMeasurements
+// counts the measurements taken in it so far. Both are guarded by the metrics lock.
+var measuredRun, runMeasurements = 0, 0
+
+func setPosition(p int) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	position = p
+}
+
+// startRun marks the start of a run of the cell, the warmup runs, which come before run 0, being ordered like it
+func startRun(run int) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	measuredRun, runMeasurements = max(run, 0), 0
+}
+
+func cellRun() int {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	return measuredRun
+}
+
+// measurementPosition is the position of a measurement taken now, with the metrics lock held: the place of its
+// experiment in the order of the run, or the place of the measurement in the run when the experiments are not ordered
+func measurementPosition() int {
+	p := position
+	if p < 0 {
+		p = runMeasurements
+	}
+	runMeasurements++
+	return p
+}
+
+func validateOrderingPolicy(policy string) error {
+	switch policy {
+	case orderFixed, orderShuffled, orderLatinSquare, orderInterleaved:
+		return nil
+	}
+	return fmt.Errorf("unknown ordering policy '%s'", policy)
+}
+
+// experimentOrder is the order to run n experiments in for the given measured run of the cell. The Latin square is the balanced one of
+// Williams, so that every experiment takes every position once, and follows every other experiment once, every n runs
+// (every 2n runs for odd n, alternating with the mirrored rows).
+func experimentOrder(n, run int) []int {
+	order := make([]int, n)
+	switch orderingPolicy {
+	case orderShuffled, orderInterleaved:
+		return rand.Perm(n)
+	case orderLatinSquare:
+		row := run % n
+		for j := range order {
+			if j%2 == 0 {
+				order[j] = (row + j/2) % n
+			} else {
+				order[j] = (row + n - (j+1)/2) % n
+			}
+		}
+		if n%2 == 1 && (run/n)%2 == 1 {
+			for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+				order[i], order[j] = order[j], order[i]
+			}
+		}
+	default:
+		for i := range order {
+			order[i] = i
+		}
+	}
+	return order
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestLatinSquareBalance checks that over a full cycle of runs, n for even n and 2n for odd n, every experiment takes
+// every position equally often and follows every other experiment equally often
+func TestLatinSquareBalance(t *testing.T) {
+	defer func(policy string) { orderingPolicy = policy }(orderingPolicy)
+	orderingPolicy = orderLatinSquare
+	for n := 2; n <= 9; n++ {
+		t.Run(fmt.Sprintf("%d experiments", n), func(t *testing.T) {
+			runs, times := n, 1
+			if n%2 == 1 {
+				runs, times = 2*n, 2
+			}
+			positions := make([][]int, n)
+			carryover := make([][]int, n)
+			for i := range positions {
+				positions[i], carryover[i] = make([]int, n), make([]int, n)
+			}
+			for run := 0; run < runs; run++ {
+				order := experimentOrder(n, run)
+				seen := make([]bool, n)
+				for p, e := range order {
+					if seen[e] {
+						t.Fatalf("run %d: experiment %d twice in %v", run, e, order)
+					}
+					seen[e] = true
+					positions[e][p]++
+					if p > 0 {
+						carryover[order[p-1]][e]++
+					}
+				}
+			}
+			for e := 0; e < n; e++ {
+				for p := 0; p < n; p++ {
+					if positions[e][p] != times {
+						t.Errorf("experiment %d at position %d %d times, expected %d", e, p, positions[e][p], times)
+					}
+				}
+				for f := 0; f < n; f++ {
+					if e != f && carryover[e][f] != times {
+						t.Errorf("experiment %d followed by %d %d times, expected %d", e, f, carryover[e][f], times)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFixedOrder(t *testing.T) {
+	defer func(policy string) { orderingPolicy = policy }(orderingPolicy)
+	orderingPolicy = orderFixed
+	for run := 0; run < 3; run++ {
+		for p, e := range experimentOrder(5, run) {
+			if p != e {
+				t.Fatalf("run %d: got %v, expected the experiments in order", run, experimentOrder(5, run))
+			}
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// profilePath is the file the profiling pass writes the query plans to, the pass is skipped when empty
+var profilePath = ""
+
+// planDiffs are the pairs of strategies whose plans the report compares, by default the IN and UNWIND lookups
+var planDiffs = [][2]string{
+	{"batch match>merge", "batch match+>merge"},
+	{"batch match>create", "batch match+>create"},
+	{"txn batch match>merge", "txn batch match+>merge"},
+	{"txn batch match>create", "txn batch match+>create"},
+}
+
+type planNode struct {
+	Operator        string     `json:"operator"`
+	Details         string     `json:"details,omitempty"`
+	Identifiers     []string   `json:"identifiers"`
+	Rows            int64      `json:"rows"`
+	DbHits          int64      `json:"dbHits"`
+	PageCacheHits   int64      `json:"pageCacheHits"`
+	PageCacheMisses int64      `json:"pageCacheMisses"`
+	Children        []planNode `json:"children,omitempty"`
+}
+
+// queryProfile is the profiled plan of one distinct query run by a strategy in a cell, with the totals over the plan tree
+type queryProfile struct {
+	Strategy        string   `json:"strategy"`
+	BatchSize       int      `json:"batchSize"`
+	ContentionRatio float64  `json:"contentionRatio"`
+	TxnMode         string   `json:"txnMode"`
+	Schema          string   `json:"schema"`
+	Query           string   `json:"query"`
+	DbHits          int64    `json:"dbHits"`
+	PageCacheHits   int64    `json:"pageCacheHits"`
+	PageCacheMisses int64    `json:"pageCacheMisses"`
+	Operators       []string `json:"operators"`
+	Plan            planNode `json:"plan"`
+}
+
+// profiling is set during the profiling pass of a cell, which runs the experiments once more with the metrics
+// discarded so that the profiling overhead never reaches a measurement
+var profiling = false
+
+func setProfiling(profile bool) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	profiling = profile
+}
+
+func isProfiling() bool {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	return profiling
+}
+
+var profilesMu sync.Mutex
+var profiles = make([]queryProfile, 0)
+
+// profiledQueries claims every distinct query of a strategy in a cell, so that only its first run is profiled
+var profiledQueries = make(map[profiledQuery]bool)
+
+type profiledQuery struct {
+	key    metricKey
+	cypher string
+}
+
+// profilingTxn profiles the first run of every distinct query of the strategy in the cell. The query is profiled in
+// place, within the transaction of the strategy, so the profile sees the graph and the locks the strategy sees.
+type profilingTxn struct {
+	transaction
+	key metricKey
+}
+
+func (tx profilingTxn) Run(ctx context.Context, cypher string, params map[string]any) (neo4j.ResultWithContext, error) {
+	key := profiledQuery{key: tx.key, cypher: cypher}
+	profilesMu.Lock()
+	claimed := profiledQueries[key]
+	profiledQueries[key] = true
+	profilesMu.Unlock()
+	if claimed {
+		return tx.transaction.Run(ctx, cypher, params)
+	}
+
+	// A failed run, such as a deadlock the driver retries, leaves the query to be profiled by the next run
+	unclaim := func() {
+		profilesMu.Lock()
+		defer profilesMu.Unlock()
+		delete(profiledQueries, key)
+	}
+	result, err := tx.transaction.Run(ctx, "PROFILE "+cypher, params)
+	if err != nil {
+		unclaim()
+		return nil, err
+	}
+	records, err := result.Collect(ctx)
+	if err != nil {
+		unclaim()
+		return nil, err
+	}
+	summary, err := result.Consume(ctx)
+	if err != nil {
+		unclaim()
+		return nil, err
+	}
+	if summary.Profile() != nil {
+		profile := queryProfile{
+			Strategy:        tx.key.name,
+			BatchSize:       tx.key.batchSize,
+			ContentionRatio: tx.key.contentionRatio,
+			TxnMode:         tx.key.txnMode,
+			Schema:          tx.key.schema,
+			Query:           cypher,
+			Operators:       make([]string, 0),
+			Plan:            toPlanNode(summary.Profile()),
+		}
+		var total func(node planNode)
+		total = func(node planNode) {
+			profile.DbHits += node.DbHits
+			profile.PageCacheHits += node.PageCacheHits
+			profile.PageCacheMisses += node.PageCacheMisses
+			profile.Operators = append(profile.Operators, node.Operator)
+			for _, child := range node.Children {
+				total(child)
+			}
+		}
+		total(profile.Plan)
+		profilesMu.Lock()
+		profiles = append(profiles, profile)
+		profilesMu.Unlock()
+	}
+	return &bufferedResult{ResultWithContext: result, records: records}, nil
+}
+
+func toPlanNode(plan neo4j.ProfiledPlan) planNode {
+	node := planNode{
+		Operator:        plan.Operator(),
+		Identifiers:     plan.Identifiers(),
+		Rows:            plan.Records(),
+		DbHits:          plan.DbHits(),
+		PageCacheHits:   plan.PageCacheHits(),
+		PageCacheMisses: plan.PageCacheMisses(),
+	}
+	if details, ok := plan.Arguments()["Details"].(string); ok {
+		node.Details = details
+	}
+	for _, child := range plan.Children() {
+		node.Children = append(node.Children, toPlanNode(child))
+	}
+	return node
+}
+
+// planLines renders the plan tree one operator per line, indented by depth, leaving out the counters so that the
+// lines of two plans only differ where their structure does
+func planLines(node planNode, depth int) []string {
+	lines := []string{strings.Repeat("  ", depth) + strings.TrimSpace(node.Operator+" "+node.Details)}
+	for _, child := range node.Children {
+		lines = append(lines, planLines(child, depth+1)...)
+	}
+	return lines
+}
+
+// diffLines is a line diff of a against b, marking the lines only in a with - and those only in b with +
+func diffLines(a, b []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	diff := make([]string, 0)
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			diff = append(diff, "  "+a[i])
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			diff = append(diff, "+ "+b[j])
+			j++
+		default:
+			diff = append(diff, "- "+a[i])
+			i++
+		}
+	}
+	return diff
+}
+
+// writeProfiles stores every profiled plan as JSON in the profile file, along with the environment
+func writeProfiles() error {
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	sort.SliceStable(profiles, func(i, j int) bool { return profiles[i].Strategy < profiles[j].Strategy })
+	content, err := json.MarshalIndent(map[string]any{"environment": environmentMap(), "profiles": profiles}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode profiles: %w", err)
+	}
+	if err := os.WriteFile(profilePath, content, 0o644); err != nil {
+		return fmt.Errorf("failed to write profiles: %w", err)
+	}
+	return nil
+}
+
+// reportPlanDiffs logs the plan totals of every profiled query, and a diff of the plans of every pair of strategies in
+// planDiffs profiled in the same cell, query by query in the order the strategies ran them
+func reportPlanDiffs() {
+	type cell struct {
+		batchSize       int
+		contentionRatio float64
+		txnMode         string
+		schema          string
+	}
+	byCell := make(map[cell]map[string][]queryProfile)
+	cells := make([]cell, 0)
+	for _, profile := range profiles {
+		log.Printf("%s:\t batch size %d\t contention ratio %.2f\t txn mode %s\t schema %s\t db hits %d\t page cache hits %d\t page cache misses %d\t %s",
+			profile.Strategy, profile.BatchSize, profile.ContentionRatio, profile.TxnMode, profile.Schema, profile.DbHits, profile.PageCacheHits, profile.PageCacheMisses, profile.Query,
+		)
+		c := cell{batchSize: profile.BatchSize, contentionRatio: profile.ContentionRatio, txnMode: profile.TxnMode, schema: profile.Schema}
+		if _, ok := byCell[c]; !ok {
+			byCell[c] = make(map[string][]queryProfile)
+			cells = append(cells, c)
+		}
+		byCell[c][profile.Strategy] = append(byCell[c][profile.Strategy], profile)
+	}
+	for _, c := range cells {
+		for _, pair := range planDiffs {
+			a, b := byCell[c][pair[0]], byCell[c][pair[1]]
+			if len(a) == 0 || len(b) == 0 {
+				continue
+			}
+			log.Printf("plan diff %s (-) vs %s (+):\t batch size %d\t contention ratio %.2f\t txn mode %s\t schema %s", pair[0], pair[1], c.batchSize, c.contentionRatio, c.txnMode, c.schema)
+			for i := 0; i < min(len(a), len(b)); i++ {
+				log.Printf("query %d:\t db hits %d vs %d\t page cache hits %d vs %d\t page cache misses %d vs %d", i+1, a[i].DbHits, b[i].DbHits, a[i].PageCacheHits, b[i].PageCacheHits, a[i].PageCacheMisses, b[i].PageCacheMisses)
+				for _, line := range diffLines(planLines(a[i].Plan, 0), planLines(b[i].Plan, 0)) {
+					log.Print(line)
+				}
+			}
+		}
+	}
+}
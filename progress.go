@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	progressAuto = "auto"
+	progressTTY  = "tty"
+	progressLog  = "log"
+)
+
+// progressMode picks how the sweep reports its progress: a live status below the scrolling logs when stdout is a
+// terminal, or a structured log line after every cell otherwise
+var progressMode = progressAuto
+
+// logOutput is where the experiments log to, which the live status takes over to keep itself below the logs
+var logOutput io.Writer = os.Stdout
+
+func validateProgressMode(mode string) error {
+	if mode != progressAuto && mode != progressTTY && mode != progressLog {
+		return fmt.Errorf("unknown progress mode '%s'", mode)
+	}
+	return nil
+}
+
+// progressCell is a batch size and contention ratio of an experiment family, which the family runs once per schema
+// variant it sweeps
+type progressCell struct {
+	family          string
+	batchSize       int
+	contentionRatio float64
+}
+
+var (
+	progressMu sync.Mutex
+	// progress is the state of the sweep, guarded by progressMu
+	progress = struct {
+		start        time.Time
+		total        int
+		done         int
+		family       string
+		familyCells  int
+		current      progressCell
+		cells        map[progressCell]int
+		liveObjects  int
+		liveElapsed  time.Duration
+		lastName     string
+		lastRate     float64
+		lastError    string
+		footerLines  int
+		out          *os.File
+		renderer     chan struct{}
+		rendererDone chan struct{}
+	}{cells: make(map[progressCell]int)}
+)
+
+// familyCells is how many cells the family runs: every batch size and contention ratio, once per schema variant for the
+// families sweeping the schema
+func familyCells(family string) int {
+	switch family {
+	case "node", "edge-upsert":
+		return len(batches) * len(contentionRatios) * len(schemaVariants)
+	case "workload":
+		if workloadSpec == "" {
+			return 0
+		}
+	}
+	return len(batches) * len(contentionRatios)
+}
+
+// startProgress starts reporting the progress of a sweep of the families, live when stdout is a terminal
+func startProgress(families []string) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progress.start = time.Now()
+	for _, family := range families {
+		progress.total += familyCells(family)
+	}
+	if progressMode == progressLog || (progressMode == progressAuto && !isTerminal(os.Stdout)) {
+		return
+	}
+	progress.out = os.Stdout
+	logOutput = statusWriter{}
+	log.SetOutput(logOutput)
+	progress.renderer, progress.rendererDone = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(progress.rendererDone)
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-progress.renderer:
+				return
+			case <-ticker.C:
+				progressMu.Lock()
+				clearStatus()
+				drawStatus()
+				progressMu.Unlock()
+			}
+		}
+	}()
+}
+
+// stopProgress removes the live status, leaving the logs
+func stopProgress() {
+	progressMu.Lock()
+	if progress.out == nil {
+		progressMu.Unlock()
+		return
+	}
+	close(progress.renderer)
+	progressMu.Unlock()
+	<-progress.rendererDone
+
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	clearStatus()
+	progress.out = nil
+	logOutput = os.Stdout
+	log.SetOutput(os.Stderr)
+}
+
+func isTerminal(file *os.File) bool {
+	return term.IsTerminal(int(file.Fd())) && os.Getenv("TERM") != "dumb"
+}
+
+func startProgressFamily(family string) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progress.family, progress.familyCells = family, familyCells(family)
+}
+
+// enterCell marks the cell the family runs the experiments of
+func enterCell(batchSize int, contentionRatio float64) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progress.current = progressCell{family: progress.family, batchSize: batchSize, contentionRatio: contentionRatio}
+}
+
+// currentCell is the cell the family runs the experiments of, empty before the first
+func currentCell() progressCell {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	return progress.current
+}
+
+// finishCell counts the cell done, logging the progress of the sweep when there is no live status
+func finishCell(batchSize int, contentionRatio float64) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progress.cells[progressCell{family: progress.family, batchSize: batchSize, contentionRatio: contentionRatio}]++
+	progress.done++
+	if progress.out != nil {
+		return
+	}
+	logger := slog.New(slog.NewTextHandler(logOutput, nil))
+	logger.Info("progress",
+		"family", progress.family,
+		"batch_size", batchSize,
+		"contention_ratio", contentionRatio,
+		"done", progress.done,
+		"cells", progress.total,
+		"elapsed", time.Since(progress.start).Round(time.Second),
+		"eta", progressETA().Round(time.Second),
+	)
+}
+
+// progressETA extrapolates the time the remaining cells take from the time the done ones took
+func progressETA() time.Duration {
+	if progress.done == 0 || progress.done >= progress.total {
+		return 0
+	}
+	perCell := time.Since(progress.start) / time.Duration(progress.done)
+	return perCell * time.Duration(progress.total-progress.done)
+}
+
+// observeProgress updates the live throughput with the objects the running executor has read and written so far
+func observeProgress(objects int, elapsed time.Duration) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progress.liveObjects, progress.liveElapsed = objects, elapsed
+}
+
+// measuredProgress shows the throughput of the latest measurement
+func measuredProgress(name string, throughput float64) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progress.lastName, progress.lastRate = name, throughput
+}
+
+func failedProgress(err error) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	// Kept to a line so that the live status does not wrap
+	message := strings.ReplaceAll(err.Error(), "\n", " ")
+	if len(message) > 100 {
+		message = message[:100] + "..."
+	}
+	progress.lastError = time.Now().Format(time.TimeOnly) + " " + message
+}
+
+// statusWriter writes the logs above the live status
+type statusWriter struct{}
+
+func (statusWriter) Write(p []byte) (int, error) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	if progress.out == nil {
+		return os.Stdout.Write(p)
+	}
+	clearStatus()
+	n, err := progress.out.Write(p)
+	drawStatus()
+	return n, err
+}
+
+// clearStatus erases the live status, with progressMu held
+func clearStatus() {
+	if progress.footerLines > 0 {
+		fmt.Fprintf(progress.out, "\x1b[%dF\x1b[J", progress.footerLines)
+		progress.footerLines = 0
+	}
+}
+
+// drawStatus draws the live status: the progress of the sweep, the matrix of cells of the running family, the live
+// throughput of the running executor and the last error, with progressMu held
+func drawStatus() {
+	lines := make([]string, 0)
+	ratio := 0.0
+	if progress.total > 0 {
+		ratio = float64(progress.done) / float64(progress.total)
+	}
+	const width = 30
+	filled := min(int(ratio*width), width)
+	lines = append(lines, fmt.Sprintf("[%s%s] %d/%d cells %3.0f%%  elapsed %s  eta %s",
+		strings.Repeat("#", filled), strings.Repeat("-", width-filled), progress.done, progress.total, ratio*100,
+		time.Since(progress.start).Round(time.Second), progressETA().Round(time.Second),
+	))
+
+	if progress.family != "" && progress.familyCells > 0 {
+		perCell := progress.familyCells / (len(batches) * len(contentionRatios))
+		header := fmt.Sprintf("%-10s", progress.family)
+		for _, contentionRatio := range contentionRatios {
+			header += fmt.Sprintf(" %5.2f", contentionRatio)
+		}
+		lines = append(lines, header)
+		for _, batchSize := range batches {
+			row := fmt.Sprintf("%10d", batchSize)
+			for _, contentionRatio := range contentionRatios {
+				cell := progressCell{family: progress.family, batchSize: batchSize, contentionRatio: contentionRatio}
+				mark := "."
+				switch {
+				case progress.cells[cell] >= perCell:
+					mark = "done"
+				case cell == progress.current:
+					mark = "run"
+				case progress.cells[cell] > 0:
+					mark = fmt.Sprintf("%d/%d", progress.cells[cell], perCell)
+				}
+				row += fmt.Sprintf(" %5s", mark)
+			}
+			lines = append(lines, row)
+		}
+	}
+
+	if progress.liveElapsed > 0 {
+		lines = append(lines, fmt.Sprintf("live throughput %.2f objects/s", float64(progress.liveObjects)/progress.liveElapsed.Seconds()))
+	}
+	if progress.lastName != "" {
+		lines = append(lines, fmt.Sprintf("last measurement %s: %.2f objects/s", progress.lastName, progress.lastRate))
+	}
+	if progress.lastError != "" {
+		lines = append(lines, "last error "+progress.lastError)
+	}
+	for _, line := range lines {
+		fmt.Fprintln(progress.out, line)
+	}
+	progress.footerLines = len(lines)
+}
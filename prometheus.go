@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// metricsListen is the address the Prometheus endpoint listens on, the endpoint is not served when empty
+var metricsListen = ""
+
+// latencyBuckets are the upper bounds in seconds of the measurement histograms
+var latencyBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// strategyStats aggregates the measurements of a strategy for the endpoint. They are guarded by the metrics lock. The
+// measurements of an unstable cell that are dropped stay in them, and are counted apart as well.
+type strategyStats struct {
+	buckets           []uint64
+	count             uint64
+	sum               float64
+	countReadObjects  uint64
+	countWriteObjects uint64
+	countRetries      uint64
+	countDeadlocks    uint64
+	countDropped      uint64
+	droppedSum        float64
+}
+
+var liveStats = make(map[string]*strategyStats)
+
+// transactionErrors counts every failed attempt of transaction work, including those retried
+var transactionErrors atomic.Uint64
+
+// countTransactionError counts a failed attempt of transaction work and shows it in the progress
+func countTransactionError(err error) {
+	transactionErrors.Add(1)
+	failedProgress(err)
+}
+
+// observeLive adds a measurement to the endpoint, with the metrics lock held
+func observeLive(key metricKey, m metric) {
+	stats, ok := liveStats[key.name]
+	if !ok {
+		stats = &strategyStats{buckets: make([]uint64, len(latencyBuckets))}
+		liveStats[key.name] = stats
+	}
+	seconds := m.totalTime.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			stats.buckets[i]++
+		}
+	}
+	stats.count++
+	stats.sum += seconds
+	stats.countReadObjects += uint64(m.countReadObjects)
+	stats.countWriteObjects += uint64(m.countWriteObjects)
+	stats.countRetries += uint64(m.countRetries)
+	stats.countDeadlocks += uint64(m.countDeadlocks)
+}
+
+// dropLive counts a measurement of an unstable cell that was dropped, with the metrics lock held. The measurement stays
+// in the other counters, which only ever go up.
+func dropLive(key metricKey, m metric) {
+	stats, ok := liveStats[key.name]
+	if !ok {
+		return
+	}
+	stats.countDropped++
+	stats.droppedSum += m.totalTime.Seconds()
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// servePrometheus writes the metrics in the Prometheus text exposition format. They are rendered under the metrics lock
+// and written once it is released, so that a slow scraper never holds up a measurement.
+func servePrometheus(w http.ResponseWriter, _ *http.Request) {
+	cell := currentCell()
+	var b bytes.Buffer
+	metricsMu.Lock()
+	fmt.Fprintln(&b, "# HELP glatency_cell_info The cell the sweep is running.")
+	fmt.Fprintln(&b, "# TYPE glatency_cell_info gauge")
+	if cell.family != "" {
+		// The position is left empty while the running experiments are not ordered
+		positionLabel := ""
+		if position >= 0 {
+			positionLabel = strconv.Itoa(position)
+		}
+		fmt.Fprintf(&b, "glatency_cell_info{family=\"%s\",batch_size=\"%d\",contention_ratio=\"%.2f\",txn_mode=\"%s\",schema=\"%s\",cache=\"%s\",position=\"%s\"} 1\n",
+			escapeLabel(cell.family), cell.batchSize, cell.contentionRatio, escapeLabel(txnMode), escapeLabel(schema), escapeLabel(cacheMode), positionLabel,
+		)
+	}
+
+	names := make([]string, 0, len(liveStats))
+	for name := range liveStats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(&b, "# HELP glatency_measurement_seconds Total time of the measurements of a strategy.")
+	fmt.Fprintln(&b, "# TYPE glatency_measurement_seconds histogram")
+	for _, name := range names {
+		stats, label := liveStats[name], escapeLabel(name)
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(&b, "glatency_measurement_seconds_bucket{strategy=\"%s\",le=\"%g\"} %d\n", label, bound, stats.buckets[i])
+		}
+		fmt.Fprintf(&b, "glatency_measurement_seconds_bucket{strategy=\"%s\",le=\"+Inf\"} %d\n", label, stats.count)
+		fmt.Fprintf(&b, "glatency_measurement_seconds_sum{strategy=\"%s\"} %g\n", label, stats.sum)
+		fmt.Fprintf(&b, "glatency_measurement_seconds_count{strategy=\"%s\"} %d\n", label, stats.count)
+	}
+	for _, counter := range []struct {
+		name, help string
+		value      func(*strategyStats) uint64
+	}{
+		{"glatency_objects_read_total", "Objects read by a strategy.", func(s *strategyStats) uint64 { return s.countReadObjects }},
+		{"glatency_objects_written_total", "Objects written by a strategy.", func(s *strategyStats) uint64 { return s.countWriteObjects }},
+		{"glatency_retries_total", "Transactions of a strategy retried by the driver.", func(s *strategyStats) uint64 { return s.countRetries }},
+		{"glatency_deadlocks_total", "Deadlocks a strategy ran into.", func(s *strategyStats) uint64 { return s.countDeadlocks }},
+		{"glatency_dropped_measurements_total", "Measurements of a strategy dropped with an unstable cell.", func(s *strategyStats) uint64 { return s.countDropped }},
+	} {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", counter.name, counter.help, counter.name)
+		for _, name := range names {
+			fmt.Fprintf(&b, "%s{strategy=\"%s\"} %d\n", counter.name, escapeLabel(name), counter.value(liveStats[name]))
+		}
+	}
+	fmt.Fprintln(&b, "# HELP glatency_dropped_measurement_seconds_total Total time of the measurements of a strategy dropped with an unstable cell.")
+	fmt.Fprintln(&b, "# TYPE glatency_dropped_measurement_seconds_total counter")
+	for _, name := range names {
+		fmt.Fprintf(&b, "glatency_dropped_measurement_seconds_total{strategy=\"%s\"} %g\n", escapeLabel(name), liveStats[name].droppedSum)
+	}
+	fmt.Fprintln(&b, "# HELP glatency_transaction_errors_total Failed attempts of transaction work, including retried ones.")
+	fmt.Fprintln(&b, "# TYPE glatency_transaction_errors_total counter")
+	fmt.Fprintf(&b, "glatency_transaction_errors_total %d\n", transactionErrors.Load())
+	metricsMu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(b.Bytes())
+}
+
+// servePrometheusEndpoint serves the metrics on /metrics for as long as the sweep runs
+func servePrometheusEndpoint() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", servePrometheus)
+	return http.ListenAndServe(metricsListen, mux)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/montanaflynn/stats"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"golang.org/x/sync/errgroup"
+)
+
+// underWrites is appended to the name of a read measured while writers are running, so that it can be compared against
+// the same read measured standalone
+const underWrites = " under writes"
+
+func RunReadExperiments(log *log.Logger, driver neo4j.DriverWithContext) error {
+	log.Print("running experiments")
+	for _, batchSize := range batches {
+		log.Printf("batch size: %d", batchSize)
+		for _, contentionRatio := range contentionRatios {
+			log.Printf("contention ratio: %.2f", contentionRatio)
+			err := forEachRun(log, driver, batchSize, contentionRatio, func() error {
+				// Create test sets
+
+				users, groups, edges := generateGraph()
+				queriesCreateUserNodes := make([]ParamedCql, 0)
+				for i := 0; i < users; i++ {
+					queriesCreateUserNodes = append(queriesCreateUserNodes, ParamedCql{
+						Query:  "CREATE (n:User{" + keyPattern("_id", "tenantId") + "}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+						Params: getUserParams(i),
+					})
+				}
+				queriesCreateGroupNodes := make([]ParamedCql, 0)
+				for i := 0; i < groups; i++ {
+					queriesCreateGroupNodes = append(queriesCreateGroupNodes, ParamedCql{
+						Query:  "CREATE (n:Group{" + keyPattern("_id", "tenantId") + "}) SET n += {id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+						Params: getGroupParams(i),
+					})
+				}
+				queriesCreateEdges := make([]ParamedCql, 0)
+				for _, edge := range edges {
+					queriesCreateEdges = append(queriesCreateEdges, ParamedCql{
+						Query:  "MATCH (u:User{" + keyPattern("user_id", "user_tenant") + "}), (g:Group{" + keyPattern("group_id", "group_tenant") + "}) CREATE (g)-[r:GROUP_USER_BINDING{`~id`: $_id}]->(u)",
+						Params: getEdgeParams(edge[0], edge[1]),
+					})
+				}
+
+				// Every read touches all users, while the contention ratio is the fraction of nodes updated by the writers
+				queriesReads := make(map[string][]ParamedCql)
+				for i := 0; i < users; i++ {
+					params := getUserParams(i)
+					queriesReads["read point lookup"] = append(queriesReads["read point lookup"], ParamedCql{
+						Query:  "MATCH (n:User{" + keyPattern("_id", "tenantId") + "}) RETURN n.`~id` AS entityId",
+						Entity: "User",
+						Params: params,
+					})
+					queriesReads["read 1-hop"] = append(queriesReads["read 1-hop"], ParamedCql{
+						Query:  "MATCH (n:User{" + keyPattern("_id", "tenantId") + "})<-[:GROUP_USER_BINDING]-(g:Group) RETURN n.`~id` AS entityId, COLLECT(g.`~id`) AS groupIds",
+						Entity: "User",
+						Params: params,
+					})
+					queriesReads["read 2-hop"] = append(queriesReads["read 2-hop"], ParamedCql{
+						Query:  "MATCH (n:User{" + keyPattern("_id", "tenantId") + "})<-[:GROUP_USER_BINDING]-(:Group)-[:GROUP_USER_BINDING]->(peer:User) RETURN n.`~id` AS entityId, COUNT(DISTINCT peer) AS peers",
+						Entity: "User",
+						Params: params,
+					})
+					queriesReads["read tenant aggregation"] = append(queriesReads["read tenant aggregation"], ParamedCql{
+						Query:  "MATCH (n:User{tenantId: $tenantId}) WHERE n.deletedAt IS NULL RETURN $tenantId AS tenantId, COUNT(n) AS users",
+						Entity: "User",
+						Params: params,
+					})
+				}
+
+				queriesUpdateUserNodes := make([]ParamedCql, 0)
+				for _, i := range generateUniqueRandomNumbers(0, users, int(float64(users)*contentionRatio)) {
+					queriesUpdateUserNodes = append(queriesUpdateUserNodes, ParamedCql{
+						Query:  "MATCH (n:User{" + keyPattern("_id", "tenantId") + "}) SET n += {name: $name + \"-Altered\", updatedAt: $updatedAt}",
+						Params: getUserParams(i),
+					})
+				}
+				queriesUpdateGroupNodes := make([]ParamedCql, 0)
+				for _, i := range generateUniqueRandomNumbers(0, groups, int(float64(groups)*contentionRatio)) {
+					queriesUpdateGroupNodes = append(queriesUpdateGroupNodes, ParamedCql{
+						Query:  "MATCH (n:Group{" + keyPattern("_id", "tenantId") + "}) SET n += {name: $name + \"-Altered\", updatedAt: $updatedAt}",
+						Params: getGroupParams(i),
+					})
+				}
+
+				// Populate the graph
+				if err := executeBlindCreateInTxnBatches(driver, "populate user nodes", queriesCreateUserNodes, batchSize, contentionRatio); err != nil {
+					return fmt.Errorf("failed to execute create queries: %w", err)
+				}
+				if err := executeBlindCreateInTxnBatches(driver, "populate group nodes", queriesCreateGroupNodes, batchSize, contentionRatio); err != nil {
+					return fmt.Errorf("failed to execute create queries: %w", err)
+				}
+				if err := executeBlindCreateInTxnBatches(driver, "populate edges", queriesCreateEdges, batchSize, contentionRatio); err != nil {
+					return fmt.Errorf("failed to execute create queries: %w", err)
+				}
+
+				if err := ExperimentReads(driver, queriesReads, batchSize, contentionRatio, ""); err != nil {
+					return err
+				}
+				if err := ExperimentReadsUnderWrites(driver, queriesReads, queriesUpdateUserNodes, queriesUpdateGroupNodes, batchSize, contentionRatio); err != nil {
+					return err
+				}
+
+				// Clear the graph
+				if err := resetGraph(driver); err != nil {
+					return fmt.Errorf("failed to clean up graph: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func ExperimentReads(driver neo4j.DriverWithContext, queriesReads map[string][]ParamedCql, batchSize int, contentionRatio float64, suffix string) error {
+	// Experiment R1: Look up, traverse and aggregate the populated graph in txn batches
+	for _, name := range []string{"read point lookup", "read 1-hop", "read 2-hop", "read tenant aggregation"} {
+		if _, err := executeReadInTxnBatches(driver, name+suffix, queriesReads[name], batchSize, contentionRatio); err != nil {
+			return fmt.Errorf("failed to execute read queries: %w", err)
+		}
+	}
+	if err := executeLookupInTxnBatches(driver, "read in lookup"+suffix, queriesReads["read point lookup"], batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute lookup queries: %w", err)
+	}
+	return nil
+}
+
+func ExperimentReadsUnderWrites(driver neo4j.DriverWithContext, queriesReads map[string][]ParamedCql, queriesUpdateUserNodes, queriesUpdateGroupNodes []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Experiment R2: Repeat the reads while the contended nodes are updated over and over
+	ctx, cancel := context.WithCancel(context.Background())
+	g := new(errgroup.Group)
+	// The writers are named apart from the updates of the edge experiments, which run at the same batch sizes and
+	// contention ratios
+	for name, queries := range map[string][]ParamedCql{"concurrent update user nodes": queriesUpdateUserNodes, "concurrent update group nodes": queriesUpdateGroupNodes} {
+		if len(queries) == 0 {
+			continue
+		}
+		g.Go(func() error {
+			return executeConcurrentWrites(ctx, driver, name, queries, batchSize, contentionRatio)
+		})
+	}
+	err := ExperimentReads(driver, queriesReads, batchSize, contentionRatio, underWrites)
+	// Stop the writers even when the reads failed, so that they do not outlive the experiment
+	cancel()
+	if err := g.Wait(); err != nil {
+		return fmt.Errorf("failed to execute transactions: %w", err)
+	}
+	return err
+}
+
+// executeConcurrentWrites runs the queries in txn batches over and over until the context is cancelled. The writes are
+// recorded as a single measurement once cancelled, so that every run records one per writer however many passes over
+// the queries fit in its reads.
+func executeConcurrentWrites(ctx context.Context, driver neo4j.DriverWithContext, name string, queries []ParamedCql, batchSize int, contentionRatio float64) error {
+	session := driver.NewSession(context.Background(), neo4j.SessionConfig{
+		AccessMode:   neo4j.AccessModeWrite,
+		DatabaseName: currentDatabase(),
+	})
+	defer session.Close(context.Background())
+	start := time.Now()
+	countWriteObjects, countWriteQueries := 0, 0
+	for i := 0; ctx.Err() == nil; i += batchSize {
+		if i >= len(queries) {
+			i = 0
+		}
+		batch := queries[i:min(i+batchSize, len(queries))]
+		updateQueryParams := make([]map[string]any, 0)
+		for _, query := range batch {
+			updateQueryParams = append(updateQueryParams, query.Params)
+		}
+		// transform "$" in query to "param."
+		newQuery := "UNWIND $params AS param " + strings.ReplaceAll(queries[i].Query, "$", "param.")
+		// The writes run outside of instrumented, so they only plan the query by themselves while priming
+		if isPriming() {
+			newQuery = "EXPLAIN " + newQuery
+		}
+		_, err := executeWrite(session, func(tx transaction) (any, error) {
+			_, err := tx.Run(context.Background(), newQuery, map[string]any{"params": updateQueryParams})
+			return nil, err
+		})
+		countWriteQueries++
+		if err != nil {
+			countTransactionError(err)
+			return fmt.Errorf("failed to execute query '%s': %w", newQuery, err)
+		}
+		countWriteObjects += len(batch)
+	}
+	latency(name, batchSize, contentionRatio, start, nil, &countWriteObjects, nil, &countWriteQueries)
+	return nil
+}
+
+// RunBackgroundReads keeps looking up random users until the context is cancelled, so that reads can be measured while
+// any of the write experiments are running. The lookups are aggregated into a single measurement per cell of the
+// sweep, timing only the lookups themselves and not the pauses between them, and recorded under the batch size and
+// contention ratio of the cell. The lookups between the cells are not recorded.
+func RunBackgroundReads(ctx context.Context, log *log.Logger, driver neo4j.DriverWithContext) error {
+	log.Print("running background reads")
+	const name = "background read point lookup"
+	const lookupSize = 100
+	query := "UNWIND $params AS param MATCH (n:User{" + strings.ReplaceAll(keyPattern("_id", "tenantId"), "$", "param.") + "}) RETURN n.`~id` AS entityId"
+
+	cell := currentCell()
+	busy, countReadObjects, countReadQueries := time.Duration(0), 0, 0
+	record := func() {
+		if countReadQueries > 0 && cell.family != "" {
+			latency(name, cell.batchSize, cell.contentionRatio, time.Now().Add(-busy), &countReadObjects, nil, &countReadQueries, nil)
+		}
+		cell = currentCell()
+		busy, countReadObjects, countReadQueries = 0, 0, 0
+	}
+	defer record()
+	for ctx.Err() == nil {
+		if currentCell() != cell {
+			record()
+		}
+		params := make([]map[string]any, 0, lookupSize)
+		for _, i := range generateUniqueRandomNumbers(0, totalObjects, lookupSize) {
+			params = append(params, getUserParams(i))
+		}
+		start := time.Now()
+		var result *neo4j.EagerResult
+		err := withDatabase(func(database string) error {
+			var err error
+			result, err = neo4j.ExecuteQuery(context.Background(), driver, query, map[string]any{"params": params}, neo4j.EagerResultTransformer,
+				neo4j.ExecuteQueryWithDatabase(database), neo4j.ExecuteQueryWithReadersRouting())
+			return err
+		})
+		if err != nil {
+			countTransactionError(err)
+			return fmt.Errorf("failed to execute query '%s': %w", query, err)
+		}
+		busy += time.Since(start)
+		countReadObjects += len(result.Records)
+		countReadQueries++
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+// reportReadDegradation logs how much slower every read got when measured under concurrent writes
+func reportReadDegradation() {
+	for key, metric := range metrics {
+		if !strings.HasSuffix(key.name, underWrites) {
+			continue
+		}
+		baseKey := key
+		baseKey.name = strings.TrimSuffix(key.name, underWrites)
+		baseMetric, ok := metrics[baseKey]
+		if !ok {
+			continue
+		}
+		totalTimeSlice, baseTotalTimeSlice := []float64{}, []float64{}
+		for _, m := range metric {
+			totalTimeSlice = append(totalTimeSlice, float64(m.totalTime.Microseconds()))
+		}
+		for _, m := range baseMetric {
+			baseTotalTimeSlice = append(baseTotalTimeSlice, float64(m.totalTime.Microseconds()))
+		}
+		totalTimeMedian, _ := stats.Median(totalTimeSlice)
+		baseTotalTimeMedian, _ := stats.Median(baseTotalTimeSlice)
+		if baseTotalTimeMedian == 0 {
+			continue
+		}
+		log.Printf("%s:\t batch size %d\t contention ratio %.2f\t read latency degradation %.2fx\t",
+			baseKey.name, key.batchSize, key.contentionRatio, totalTimeMedian/baseTotalTimeMedian,
+		)
+	}
+}
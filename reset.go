@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+const (
+	resetDetachDelete    = "detach-delete"
+	resetBatched         = "batched"
+	resetReplaceDatabase = "replace-database"
+	resetThrowaway       = "throwaway"
+)
+
+var resetStrategy = resetDetachDelete
+
+// throwawayDatabases counts the databases created by the throwaway strategy, naming the next one
+var throwawayDatabases = 0
+
+// resetTimesPath is the file the time of every reset is written to, the times are only logged when empty
+var resetTimesPath = ""
+
+// resetTime is how long a reset took, and in which cell
+type resetTime struct {
+	strategy string
+	cell     progressCell
+	took     time.Duration
+}
+
+// resetTimes holds how long every reset took, apart from the metrics so that resets never pollute the measurements
+var resetTimesMu sync.Mutex
+var resetTimes = make([]resetTime, 0)
+
+func validateResetStrategy(strategy string) error {
+	switch strategy {
+	case resetDetachDelete, resetBatched, resetReplaceDatabase, resetThrowaway:
+		return nil
+	}
+	return fmt.Errorf("unknown reset strategy '%s'", strategy)
+}
+
+// resetGraph empties the graph with the configured strategy. The database strategies start from a blank database, so
+// they re-apply the current schema.
+func resetGraph(driver neo4j.DriverWithContext) error {
+	start := time.Now()
+	defer func() {
+		resetTimesMu.Lock()
+		defer resetTimesMu.Unlock()
+		resetTimes = append(resetTimes, resetTime{strategy: resetStrategy, cell: currentCell(), took: time.Since(start)})
+	}()
+
+	switch resetStrategy {
+	case resetBatched:
+		// CALL { } IN TRANSACTIONS needs an auto-commit transaction
+		session := driver.NewSession(context.Background(), neo4j.SessionConfig{
+			AccessMode:   neo4j.AccessModeWrite,
+			DatabaseName: currentDatabase(),
+		})
+		defer session.Close(context.Background())
+		result, err := session.Run(context.Background(), "MATCH (n) CALL { WITH n DETACH DELETE n } IN TRANSACTIONS OF 10000 ROWS", nil)
+		if err == nil {
+			_, err = result.Consume(context.Background())
+		}
+		if err != nil {
+			return fmt.Errorf("failed to clean up graph: %w", err)
+		}
+		return nil
+	case resetReplaceDatabase:
+		name := currentDatabase()
+		if name == "" {
+			result, err := neo4j.ExecuteQuery(context.Background(), driver, "SHOW DEFAULT DATABASE YIELD name", nil, neo4j.EagerResultTransformer, neo4j.ExecuteQueryWithDatabase("system"))
+			if err != nil {
+				return fmt.Errorf("failed to clean up graph: %w", err)
+			}
+			defaultName, _ := result.Records[0].Get("name")
+			name = defaultName.(string)
+		}
+		err := replacingDatabase(func() error {
+			return executeSystemQuery(driver, "CREATE OR REPLACE DATABASE $name WAIT", map[string]any{"name": name})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to clean up graph: %w", err)
+		}
+		return applySchema(driver, schema)
+	case resetThrowaway:
+		previous := currentDatabase()
+		throwawayDatabases++
+		name := fmt.Sprintf("glatency-throwaway-%d-%d", os.Getpid(), throwawayDatabases)
+		if err := executeSystemQuery(driver, "CREATE DATABASE $name WAIT", map[string]any{"name": name}); err != nil {
+			return fmt.Errorf("failed to clean up graph: %w", err)
+		}
+		setDatabase(name)
+		// Only a previous throwaway database is dropped, never the one the family started in
+		if strings.HasPrefix(previous, "glatency-throwaway-") {
+			if err := executeSystemQuery(driver, "DROP DATABASE $name IF EXISTS", map[string]any{"name": previous}); err != nil {
+				return fmt.Errorf("failed to clean up graph: %w", err)
+			}
+		}
+		return applySchema(driver, schema)
+	default:
+		return executeTxn(driver, "cleanup", 0, 0.0, cleanUpGraphTxn(), true)
+	}
+}
+
+// restoreDatabase moves back to the database the sweep or a family started in, dropping the throwaway database the
+// resets left it in
+func restoreDatabase(driver neo4j.DriverWithContext, database string) error {
+	current := currentDatabase()
+	if current == database || !strings.HasPrefix(current, "glatency-throwaway-") {
+		return nil
+	}
+	setDatabase(database)
+	return executeSystemQuery(driver, "DROP DATABASE $name IF EXISTS", map[string]any{"name": current})
+}
+
+// reportResetTimes logs how much time went into resetting the graph, which is excluded from every measurement
+func reportResetTimes() {
+	totals, counts := make(map[string]time.Duration), make(map[string]int)
+	for _, reset := range resetTimes {
+		totals[reset.strategy] += reset.took
+		counts[reset.strategy]++
+	}
+	for strategy, total := range totals {
+		log.Printf("reset %s:\t count %d\t total time %s\t mean time %s\t", strategy, counts[strategy], total, total/time.Duration(counts[strategy]))
+	}
+}
+
+// writeResetTimes stores the time of every reset as CSV, along with the cell it reset the graph in
+func writeResetTimes() error {
+	file, err := os.Create(resetTimesPath)
+	if err != nil {
+		return fmt.Errorf("failed to create reset times file: %w", err)
+	}
+	defer file.Close()
+	if err := writeEnvironment(resetTimesPath); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"Strategy", "Family", "Batch Size", "Contention Ratio", "Time"}); err != nil {
+		return fmt.Errorf("failed to write reset times: %w", err)
+	}
+	for _, reset := range resetTimes {
+		record := []string{reset.strategy, reset.cell.family, "", "", fmt.Sprintf("%d", reset.took.Milliseconds())}
+		// The reset before the first cell belongs to none
+		if reset.cell.family != "" {
+			record[2] = fmt.Sprintf("%d", reset.cell.batchSize)
+			record[3] = fmt.Sprintf("%.2f", reset.cell.contentionRatio)
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write reset times: %w", err)
+		}
+	}
+	return nil
+}
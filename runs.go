@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+const (
+	cacheModeWarm = "warm"
+	cacheModeCold = "cold"
+)
+
+var (
+	warmupRuns = 0
+	primePlans = false
+	cacheModes = []string{cacheModeWarm}
+)
+
+// cacheMode labels the measurements with whether the query caches were kept (warm) or cleared before every run
+// (cold). Like txnMode it only changes between runs, under the metrics lock.
+var cacheMode = cacheModeWarm
+
+// discardMetrics is set during the priming and warmup runs, which are executed but not measured
+var discardMetrics = false
+
+// priming makes the executors EXPLAIN their queries instead of running them, planning and caching every generated
+// query without touching the graph
+var priming = false
+
+func setCacheMode(mode string) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	cacheMode = mode
+}
+
+func setDiscardMetrics(discard bool) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	discardMetrics = discard
+}
+
+func setPriming(prime bool) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	priming = prime
+}
+
+func isPriming() bool {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	return priming
+}
+
+func validateCacheMode(mode string) error {
+	if mode != cacheModeWarm && mode != cacheModeCold {
+		return fmt.Errorf("unknown cache mode '%s'", mode)
+	}
+	return nil
+}
+
+// forEachRun runs the experiments of a cell: once to prime the query plan cache and once to profile the queries when
+// asked to, then the warmup runs and the measured runs in every cache mode. Only the measured runs are recorded. The
+// first error of the experiments ends the runs.
+func forEachRun(log *log.Logger, driver neo4j.DriverWithContext, batchSize int, contentionRatio float64, experiments func() error) error {
+	enterCell(batchSize, contentionRatio)
+	defer finishCell(batchSize, contentionRatio)
+	if primePlans {
+		log.Print("priming run")
+		setDiscardMetrics(true)
+		setPriming(true)
+		if err := experiments(); err != nil {
+			return err
+		}
+		setPriming(false)
+	}
+	if profilePath != "" {
+		log.Print("profiling run")
+		setDiscardMetrics(true)
+		setProfiling(true)
+		if err := experiments(); err != nil {
+			return err
+		}
+		setProfiling(false)
+	}
+	for _, mode := range cacheModes {
+		log.Printf("cache mode: %s", mode)
+		setCacheMode(mode)
+		err := measureRuns(log, true, func(bool) error {
+			if err := coldStart(driver); err != nil {
+				return err
+			}
+			return experiments()
+		})
+		if err != nil {
+			return err
+		}
+	}
+	setCacheMode(cacheModeWarm)
+	return nil
+}
+
+// forEachInterleavedRun is forEachRun over all cells at once, every run visiting the cells in a shuffled order so that
+// the runs of a cell are spread over the whole sweep. Unstable cells are not rerun, their runs being spread as well.
+// A cell is finished as soon as its last run is done, or once the runs are over when the confidence intervals kept
+// them going.
+func forEachInterleavedRun(log *log.Logger, driver neo4j.DriverWithContext, cells int, experiments func(cell int) error, finish func(cell int)) error {
+	if primePlans {
+		log.Print("priming run")
+		setDiscardMetrics(true)
+		setPriming(true)
+		for cell := 0; cell < cells; cell++ {
+			if err := experiments(cell); err != nil {
+				return err
+			}
+		}
+		setPriming(false)
+	}
+	if profilePath != "" {
+		log.Print("profiling run")
+		setDiscardMetrics(true)
+		setProfiling(true)
+		for cell := 0; cell < cells; cell++ {
+			if err := experiments(cell); err != nil {
+				return err
+			}
+		}
+		setProfiling(false)
+	}
+	finished := make([]bool, cells)
+	for i, mode := range cacheModes {
+		log.Printf("cache mode: %s", mode)
+		setCacheMode(mode)
+		err := measureRuns(log, false, func(last bool) error {
+			for _, cell := range rand.Perm(cells) {
+				if err := coldStart(driver); err != nil {
+					return err
+				}
+				if err := experiments(cell); err != nil {
+					return err
+				}
+				if last && i == len(cacheModes)-1 {
+					finish(cell)
+					finished[cell] = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	setCacheMode(cacheModeWarm)
+	for cell := 0; cell < cells; cell++ {
+		if !finished[cell] {
+			finish(cell)
+		}
+	}
+	return nil
+}
+
+// measureRuns runs the warmup runs and then the measured runs, beyond runs up to maxRuns as long as the confidence
+// intervals are wider than the target. When rerun is set and the measurements came out too variable they are dropped
+// and the runs start over, up to cellReruns times. runOnce is told whether the run is the last one planned, which it
+// is for sure unless the confidence intervals or a rerun keep the runs going.
+func measureRuns(log *log.Logger, rerun bool, runOnce func(last bool) error) error {
+	for attempt := 0; ; attempt++ {
+		before := snapshotMetrics()
+		for run := -warmupRuns; run < runs || (run < maxRuns && !precise(before)); run++ {
+			if run < 0 {
+				log.Printf("warmup run: %d", run+warmupRuns+1)
+			} else {
+				log.Printf("run: %d", run+1)
+			}
+			setDiscardMetrics(run < 0)
+			startRun(run)
+			if err := runOnce(run+1 >= runs && (ciWidth <= 0 || run+1 >= maxRuns)); err != nil {
+				return err
+			}
+		}
+		setDiscardMetrics(false)
+		if !rerun || attempt >= cellReruns || stable(before) {
+			return nil
+		}
+		log.Printf("rerunning: coefficient of variation above %.2f", maxCV)
+		dropMetrics(before)
+	}
+}
+
+// coldStart clears the query caches before every run in the cold cache mode, the one place they are cleared
+func coldStart(driver neo4j.DriverWithContext) error {
+	metricsMu.Lock()
+	cold := cacheMode == cacheModeCold
+	metricsMu.Unlock()
+	if !cold {
+		return nil
+	}
+	if err := clearQueryCaches(driver); err != nil {
+		return fmt.Errorf("failed to clear query caches: %w", err)
+	}
+	return nil
+}
+
+// clearQueryCaches empties the query plan caches. The page cache cannot be flushed from Cypher, so cold only means cold
+// plans.
+func clearQueryCaches(driver neo4j.DriverWithContext) error {
+	if _, err := neo4j.ExecuteQuery(context.Background(), driver, "CALL db.clearQueryCaches()", nil, neo4j.EagerResultTransformer, neo4j.ExecuteQueryWithDatabase(currentDatabase())); err != nil {
+		return fmt.Errorf("failed to execute query 'CALL db.clearQueryCaches()': %w", err)
+	}
+	return nil
+}
+
+// instrumented wraps the transaction work of a strategy for the priming and profiling passes, counting its errors and tracing it
+func instrumented(run *execution, work transactionWork) transactionWork {
+	work = tracedWork(run.span, run.name, work)
+	return func(tx transaction) (any, error) {
+		var result any
+		var err error
+		switch {
+		case isPriming():
+			result, err = work(primingTxn{transaction: tx})
+		case isProfiling():
+			metricsMu.Lock()
+			key := metricKeyOf(run.name, run.batchSize, run.contentionRatio)
+			metricsMu.Unlock()
+			result, err = work(profilingTxn{transaction: tx, key: key})
+		default:
+			result, err = work(tx)
+		}
+		if err != nil {
+			countTransactionError(err)
+		}
+		return result, err
+	}
+}
+
+// primingTxn only plans the queries it is given, which return no records
+type primingTxn struct {
+	transaction
+}
+
+func (tx primingTxn) Run(ctx context.Context, cypher string, params map[string]any) (neo4j.ResultWithContext, error) {
+	return tx.transaction.Run(ctx, "EXPLAIN "+cypher, params)
+}
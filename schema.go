@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+const defaultSchema = "unique+rel"
+
+// schemaVariants are applied in turn to every cell of the node and edge upsert experiments. A variant names how the
+// node `~id` is indexed (none, range, unique, node-key or text), optionally followed by +rel to also put a uniqueness
+// constraint on the relationship `~id`.
+var schemaVariants = []string{defaultSchema}
+
+var nodeSchemas = map[string]string{
+	"none":     "",
+	"range":    "CREATE RANGE INDEX %s_id IF NOT EXISTS FOR (n:%s) ON (%s)",
+	"unique":   "CREATE CONSTRAINT %s_id IF NOT EXISTS FOR (n:%s) REQUIRE (%s) IS UNIQUE",
+	"node-key": "CREATE CONSTRAINT %s_id IF NOT EXISTS FOR (n:%s) REQUIRE (%s) IS NODE KEY",
+	"text":     "CREATE TEXT INDEX %s_id IF NOT EXISTS FOR (n:%s) ON (%s)",
+}
+
+// schema is the variant currently applied, labelling the measurements taken under it
+var schema = defaultSchema
+
+func validateSchema(variant string) error {
+	nodeSchema, relationshipSchema, _ := strings.Cut(variant, "+")
+	if _, ok := nodeSchemas[nodeSchema]; !ok {
+		return fmt.Errorf("unknown schema '%s'", nodeSchema)
+	}
+	if relationshipSchema != "" && relationshipSchema != "rel" {
+		return fmt.Errorf("unknown relationship schema '%s'", relationshipSchema)
+	}
+	return nil
+}
+
+// schemaNames are the names of the constraints and indexes the variants create, the only ones applySchema drops so that
+// the rest of the schema of a shared database is left alone
+var schemaNames = []string{"user_id", "group_id", "group_user_binding_id"}
+
+// applySchema drops the constraints and indexes of the previous variant and creates the ones of the variant, waiting
+// for the indexes to come online before returning
+func applySchema(driver neo4j.DriverWithContext, variant string) error {
+	if err := validateSchema(variant); err != nil {
+		return err
+	}
+	nodeSchema, relationshipSchema, _ := strings.Cut(variant, "+")
+
+	// Dropping a constraint drops its backing index, so the indexes are listed only after the constraints are gone
+	for _, listing := range []string{
+		"SHOW CONSTRAINTS YIELD name WHERE name IN $names RETURN 'DROP CONSTRAINT `' + name + '`' AS query",
+		"SHOW INDEXES YIELD name, type WHERE name IN $names AND type <> 'LOOKUP' RETURN 'DROP INDEX `' + name + '`' AS query",
+	} {
+		result, err := neo4j.ExecuteQuery(context.Background(), driver, listing, map[string]any{"names": schemaNames}, neo4j.EagerResultTransformer, neo4j.ExecuteQueryWithDatabase(currentDatabase()))
+		if err != nil {
+			return fmt.Errorf("failed to execute query '%s': %w", listing, err)
+		}
+		for _, record := range result.Records {
+			query, _ := record.Get("query")
+			if _, err := neo4j.ExecuteQuery(context.Background(), driver, query.(string), nil, neo4j.EagerResultTransformer, neo4j.ExecuteQueryWithDatabase(currentDatabase())); err != nil {
+				return fmt.Errorf("failed to execute query '%s': %w", query, err)
+			}
+		}
+	}
+
+	queries := make([]string, 0)
+	if nodeSchemas[nodeSchema] != "" {
+		for _, node := range []string{"User", "Group"} {
+			properties := "n.`~id`"
+			if tenantScopedIds && nodeSchema != "text" {
+				properties = "n.tenantId, n.`~id`"
+			}
+			queries = append(queries, fmt.Sprintf(nodeSchemas[nodeSchema], strings.ToLower(node), node, properties))
+		}
+	}
+	if relationshipSchema == "rel" {
+		for _, relationship := range []string{"GROUP_USER_BINDING"} {
+			queries = append(queries, fmt.Sprintf("CREATE CONSTRAINT %s_id IF NOT EXISTS FOR ()-[r:%s]-() REQUIRE r.`~id` IS UNIQUE", strings.ToLower(relationship), relationship))
+		}
+	}
+	queries = append(queries, "CALL db.awaitIndexes(300)")
+	for _, query := range queries {
+		if _, err := neo4j.ExecuteQuery(context.Background(), driver, query, nil, neo4j.EagerResultTransformer, neo4j.ExecuteQueryWithDatabase(currentDatabase())); err != nil {
+			return fmt.Errorf("failed to execute query '%s': %w", query, err)
+		}
+	}
+
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	schema = variant
+	return nil
+}
+
+// ensureSchema applies the variant unless it is the one applied already, for the interleaved runs that revisit the
+// cells of every variant in turn
+func ensureSchema(driver neo4j.DriverWithContext, variant string) error {
+	metricsMu.Lock()
+	current := schema
+	metricsMu.Unlock()
+	if current == variant {
+		return nil
+	}
+	return applySchema(driver, variant)
+}
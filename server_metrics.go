@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+var (
+	serverMetricsPath     = ""
+	serverMetricsInterval = time.Second
+	prometheusURL         = ""
+	prometheusMetrics     = regexp.MustCompile(`^neo4j_.*(check_point|transaction|page_cache|vm_gc|vm_heap|vm_pause)`)
+)
+
+// maxServerMetricsBackoff bounds how long a failing source is left alone before it is sampled again
+const maxServerMetricsBackoff = 5 * time.Minute
+
+// serverSample is one value of the server state, taken while the experiments run, along with the cell running then
+type serverSample struct {
+	at     time.Time
+	cell   sampledCell
+	source string
+	name   string
+	value  float64
+}
+
+// sampledCell is the cell of the sweep at the time of a sample
+type sampledCell struct {
+	progressCell
+	txnMode   string
+	schema    string
+	cacheMode string
+}
+
+var serverSamplesMu sync.Mutex
+var serverSamples = make([]serverSample, 0)
+
+func recordServerSample(at time.Time, source, name string, value float64) {
+	cell := sampledCell{progressCell: currentCell()}
+	metricsMu.Lock()
+	cell.txnMode, cell.schema, cell.cacheMode = txnMode, schema, cacheMode
+	metricsMu.Unlock()
+	serverSamplesMu.Lock()
+	defer serverSamplesMu.Unlock()
+	serverSamples = append(serverSamples, serverSample{at: at, cell: cell, source: source, name: name, value: value})
+}
+
+// serverMetricsSource is a source of server samples along with when to sample it next, which a failure pushes back
+type serverMetricsSource struct {
+	sample   func(driver neo4j.DriverWithContext, database string, at time.Time) error
+	failures int
+	next     time.Time
+}
+
+// RunServerMetricsSampler samples the server state every interval until the context is done. A source that fails, such
+// as JMX on Aura, Prometheus on Community or any source while a database is being replaced, is sampled again after a
+// backoff doubling with every failure in a row, up to maxServerMetricsBackoff.
+func RunServerMetricsSampler(ctx context.Context, log *log.Logger, driver neo4j.DriverWithContext) error {
+	log.Print("sampling server metrics")
+	sources := map[string]*serverMetricsSource{
+		"transactions": {sample: sampleTransactions},
+		"jmx":          {sample: sampleJmx},
+	}
+	if prometheusURL != "" {
+		sources["prometheus"] = &serverMetricsSource{sample: samplePrometheus}
+	}
+	ticker := time.NewTicker(serverMetricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case at := <-ticker.C:
+			for name, source := range sources {
+				if at.Before(source.next) {
+					continue
+				}
+				err := withDatabase(func(database string) error {
+					return source.sample(driver, database, at)
+				})
+				if err != nil {
+					backoff := min(serverMetricsInterval<<min(source.failures, 16), maxServerMetricsBackoff)
+					source.failures++
+					source.next = at.Add(backoff)
+					log.Printf("not sampling %s metrics for %s: %v", name, backoff, err)
+					continue
+				}
+				if source.failures > 0 {
+					log.Printf("sampling %s metrics again", name)
+				}
+				source.failures, source.next = 0, time.Time{}
+			}
+		}
+	}
+}
+
+func sampleTransactions(driver neo4j.DriverWithContext, database string, at time.Time) error {
+	result, err := neo4j.ExecuteQuery(context.Background(), driver,
+		"SHOW TRANSACTIONS YIELD status, activeLockCount, waitTime RETURN count(*) AS transactions, count(CASE WHEN status STARTS WITH 'Blocked' THEN 1 END) AS blocked, sum(activeLockCount) AS locks, sum(waitTime.milliseconds) AS waitTime",
+		nil, neo4j.EagerResultTransformer, neo4j.ExecuteQueryWithDatabase(database))
+	if err != nil {
+		return err
+	}
+	for _, key := range result.Records[0].Keys {
+		value, _ := result.Records[0].Get(key)
+		if count, ok := value.(int64); ok {
+			recordServerSample(at, "transactions", key, float64(count))
+		}
+	}
+	return nil
+}
+
+// sampleJmx records the garbage collections and the heap usage of the server JVM
+func sampleJmx(driver neo4j.DriverWithContext, database string, at time.Time) error {
+	result, err := neo4j.ExecuteQuery(context.Background(), driver,
+		"CALL dbms.queryJmx('java.lang:*') YIELD name, attributes WHERE name STARTS WITH 'java.lang:type=GarbageCollector' OR name = 'java.lang:type=Memory' RETURN name, attributes",
+		nil, neo4j.EagerResultTransformer, neo4j.ExecuteQueryWithDatabase(database))
+	if err != nil {
+		return err
+	}
+	// Every attribute is a map holding its value, composite values being maps themselves
+	attribute := func(attributes map[string]any, name string) any {
+		if attribute, ok := attributes[name].(map[string]any); ok {
+			return attribute["value"]
+		}
+		return nil
+	}
+	for _, record := range result.Records {
+		name, _ := record.Get("name")
+		value, _ := record.Get("attributes")
+		attributes, _ := value.(map[string]any)
+		if name == "java.lang:type=Memory" {
+			if heap, ok := attribute(attributes, "HeapMemoryUsage").(map[string]any); ok {
+				if used, ok := heap["used"].(int64); ok {
+					recordServerSample(at, "jmx", "heap used", float64(used))
+				}
+			}
+			continue
+		}
+		collector := strings.TrimPrefix(name.(string), "java.lang:type=GarbageCollector,name=")
+		if count, ok := attribute(attributes, "CollectionCount").(int64); ok {
+			recordServerSample(at, "jmx", collector+" collection count", float64(count))
+		}
+		if collectionTime, ok := attribute(attributes, "CollectionTime").(int64); ok {
+			recordServerSample(at, "jmx", collector+" collection time", float64(collectionTime))
+		}
+	}
+	return nil
+}
+
+// samplePrometheus scrapes the Prometheus endpoint of the server, keeping the metrics matching prometheusMetrics
+func samplePrometheus(_ neo4j.DriverWithContext, _ string, at time.Time) error {
+	// A scrape never outlasts the interval, so that a hung endpoint cannot hold up the other sources
+	client := http.Client{Timeout: serverMetricsInterval}
+	response, err := client.Get(prometheusURL)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status '%s'", response.Status)
+	}
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// A sample is the metric name with its optional labels, the value and an optional timestamp
+		name, rest := line, ""
+		if i := strings.LastIndex(line, "}"); i >= 0 {
+			name, rest = line[:i+1], line[i+1:]
+		} else if i := strings.IndexByte(line, ' '); i >= 0 {
+			name, rest = line[:i], line[i:]
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 || !prometheusMetrics.MatchString(name) {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		recordServerSample(at, "prometheus", name, value)
+	}
+	return scanner.Err()
+}
+
+// writeServerMetrics stores the server samples as CSV, every sample along with the cell running when it was taken
+func writeServerMetrics() error {
+	file, err := os.Create(serverMetricsPath)
+	if err != nil {
+		return fmt.Errorf("failed to create server metrics file: %w", err)
+	}
+	defer file.Close()
+	if err := writeEnvironment(serverMetricsPath); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"Time", "Source", "Name", "Value", "Family", "Batch Size", "Contention Ratio", "Txn Mode", "Schema", "Cache"}); err != nil {
+		return fmt.Errorf("failed to write server metrics: %w", err)
+	}
+	sort.SliceStable(serverSamples, func(i, j int) bool { return serverSamples[i].at.Before(serverSamples[j].at) })
+	for _, sample := range serverSamples {
+		record := []string{
+			sample.at.Format(time.RFC3339Nano),
+			sample.source,
+			sample.name,
+			strconv.FormatFloat(sample.value, 'f', -1, 64),
+			sample.cell.family,
+			"",
+			"",
+			sample.cell.txnMode,
+			sample.cell.schema,
+			sample.cell.cacheMode,
+		}
+		// Samples taken before the first cell belong to none
+		if sample.cell.family != "" {
+			record[5] = fmt.Sprintf("%d", sample.cell.batchSize)
+			record[6] = fmt.Sprintf("%.2f", sample.cell.contentionRatio)
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write server metrics: %w", err)
+		}
+	}
+	return nil
+}
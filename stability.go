@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/montanaflynn/stats"
+)
+
+const (
+	outliersMad = "mad"
+	outliersIqr = "iqr"
+)
+
+var (
+	// ciWidth is the target width of the 95% confidence interval of the mean total time, relative to the mean. Cells
+	// keep running past runs until every measurement of the cell is that precise, 0 to always stop at runs.
+	ciWidth = 0.0
+	maxRuns = 50
+	// maxCV is the coefficient of variation of the total time above which a cell is rerun, 0 to never rerun
+	maxCV      = 0.0
+	cellReruns = 1
+	outliers   = outliersMad
+)
+
+// tCritical is the two-sided 95% critical value of the t distribution for 1 to 30 degrees of freedom
+var tCritical = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+func validateOutliers(method string) error {
+	if method != outliersMad && method != outliersIqr {
+		return fmt.Errorf("unknown outlier method '%s'", method)
+	}
+	return nil
+}
+
+// setupSteps are the measurements of the steps populating the graph for a strategy, rather than of a strategy
+var setupSteps = map[string]bool{
+	"create":           true,
+	"batch create":     true,
+	"txn batch create": true,
+	"user nodes":       true,
+	"group nodes":      true,
+}
+
+// isStrategy reports whether a measurement is of a strategy, rather than of a setup step or of the load running
+// alongside the strategies, such as the background reads and the writers the reads are measured under
+func isStrategy(name string) bool {
+	return !setupSteps[name] && !strings.HasPrefix(name, "populate ") && !strings.HasPrefix(name, "background ") && !strings.HasPrefix(name, "concurrent ")
+}
+
+// metricsSnapshot counts the measurements and the timelines of every key, marking where those of a cell start
+type metricsSnapshot struct {
+	metrics   map[metricKey]int
+	timelines map[metricKey]int
+}
+
+func snapshotMetrics() metricsSnapshot {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	snapshot := metricsSnapshot{metrics: make(map[metricKey]int), timelines: make(map[metricKey]int)}
+	for key, ms := range metrics {
+		snapshot.metrics[key] = len(ms)
+	}
+	for key, runs := range timelines {
+		snapshot.timelines[key] = len(runs)
+	}
+	return snapshot
+}
+
+// samplesSince returns the total times in milliseconds measured for every strategy since the snapshot
+func samplesSince(snapshot metricsSnapshot) map[metricKey][]float64 {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	samples := make(map[metricKey][]float64)
+	for key, ms := range metrics {
+		if !isStrategy(key.name) {
+			continue
+		}
+		for _, m := range ms[snapshot.metrics[key]:] {
+			samples[key] = append(samples[key], float64(m.totalTime.Microseconds())/1000)
+		}
+	}
+	return samples
+}
+
+// dropMetrics forgets every measurement and timeline taken since the snapshot, counting the measurements as dropped in
+// the live statistics
+func dropMetrics(snapshot metricsSnapshot) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	for key, ms := range metrics {
+		for _, m := range ms[snapshot.metrics[key]:] {
+			dropLive(key, m)
+		}
+		if snapshot.metrics[key] == 0 {
+			delete(metrics, key)
+			continue
+		}
+		metrics[key] = ms[:snapshot.metrics[key]]
+	}
+	for key, runs := range timelines {
+		if snapshot.timelines[key] == 0 {
+			delete(timelines, key)
+			continue
+		}
+		timelines[key] = runs[:snapshot.timelines[key]]
+	}
+}
+
+// relativeCIWidth is the width of the 95% confidence interval of the mean, relative to the mean
+func relativeCIWidth(samples []float64) float64 {
+	n := len(samples)
+	if n < 2 {
+		return math.Inf(1)
+	}
+	mean, _ := stats.Mean(samples)
+	sd, _ := stats.StandardDeviationSample(samples)
+	t := 1.96
+	if n-1 <= len(tCritical) {
+		t = tCritical[n-2]
+	}
+	return relativeTo(2*t*sd/math.Sqrt(float64(n)), mean)
+}
+
+func coefficientOfVariation(samples []float64) float64 {
+	mean, _ := stats.Mean(samples)
+	sd, _ := stats.StandardDeviationSample(samples)
+	return relativeTo(sd, mean)
+}
+
+// relativeTo is the spread relative to the mean. The measurements too short to be timed have a zero mean, and are
+// only as precise as they get when they do not spread either.
+func relativeTo(spread, mean float64) float64 {
+	switch {
+	case mean != 0:
+		return spread / math.Abs(mean)
+	case spread == 0:
+		return 0
+	default:
+		return math.Inf(1)
+	}
+}
+
+// precise reports whether every strategy measured since the snapshot has a confidence interval within the target width
+func precise(snapshot metricsSnapshot) bool {
+	if ciWidth <= 0 {
+		return true
+	}
+	for _, samples := range samplesSince(snapshot) {
+		if relativeCIWidth(samples) > ciWidth {
+			return false
+		}
+	}
+	return true
+}
+
+// stable reports whether every strategy measured since the snapshot varies less than maxCV
+func stable(snapshot metricsSnapshot) bool {
+	if maxCV <= 0 {
+		return true
+	}
+	for _, samples := range samplesSince(snapshot) {
+		if len(samples) > 1 && coefficientOfVariation(samples) > maxCV {
+			return false
+		}
+	}
+	return true
+}
+
+// flagOutliers marks the values that are outliers by the configured method: further than 3.5 scaled median absolute
+// deviations from the median, or further than 1.5 interquartile ranges outside the quartiles
+func flagOutliers(values []float64) []bool {
+	flags := make([]bool, len(values))
+	if len(values) < 3 {
+		return flags
+	}
+	switch outliers {
+	case outliersIqr:
+		quartiles, err := stats.Quartile(values)
+		if err != nil {
+			return flags
+		}
+		iqr := quartiles.Q3 - quartiles.Q1
+		for i, v := range values {
+			flags[i] = v < quartiles.Q1-1.5*iqr || v > quartiles.Q3+1.5*iqr
+		}
+	default:
+		median, _ := stats.Median(values)
+		mad, _ := stats.MedianAbsoluteDeviation(values)
+		if mad == 0 {
+			return flags
+		}
+		for i, v := range values {
+			flags[i] = math.Abs(v-median)/(1.4826*mad) > 3.5
+		}
+	}
+	return flags
+}
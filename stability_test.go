@@ -0,0 +1,32 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFlagOutliers(t *testing.T) {
+	defer func(method string) { outliers = method }(outliers)
+	for _, test := range []struct {
+		name     string
+		method   string
+		values   []float64
+		expected []bool
+	}{
+		{"mad too few", outliersMad, []float64{1, 100}, []bool{false, false}},
+		{"mad none", outliersMad, []float64{10, 11, 9, 10, 12, 10}, []bool{false, false, false, false, false, false}},
+		{"mad high", outliersMad, []float64{10, 11, 9, 10, 12, 10, 40}, []bool{false, false, false, false, false, false, true}},
+		{"mad low", outliersMad, []float64{1, 100, 101, 99, 100, 102}, []bool{true, false, false, false, false, false}},
+		{"mad constant", outliersMad, []float64{5, 5, 5, 5}, []bool{false, false, false, false}},
+		{"iqr none", outliersIqr, []float64{10, 11, 9, 10, 12, 10}, []bool{false, false, false, false, false, false}},
+		{"iqr high", outliersIqr, []float64{10, 11, 9, 10, 12, 10, 40}, []bool{false, false, false, false, false, false, true}},
+		{"iqr both", outliersIqr, []float64{-50, 10, 11, 9, 10, 12, 10, 60}, []bool{true, false, false, false, false, false, false, true}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			outliers = test.method
+			if got := flagOutliers(test.values); !slices.Equal(got, test.expected) {
+				t.Errorf("got %v, expected %v", got, test.expected)
+			}
+		})
+	}
+}
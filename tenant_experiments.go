@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"golang.org/x/sync/errgroup"
+)
+
+func RunTenantExperiments(log *log.Logger, driver neo4j.DriverWithContext) error {
+	if len(tenantNames) < 2 {
+		log.Print("skipping tenant experiments: single tenant")
+		return nil
+	}
+	log.Print("running experiments")
+	for _, batchSize := range batches {
+		log.Printf("batch size: %d", batchSize)
+		for _, contentionRatio := range contentionRatios {
+			log.Printf("contention ratio: %.2f", contentionRatio)
+			err := forEachRun(log, driver, batchSize, contentionRatio, func() error {
+				// Create test sets
+
+				preCreatedObjects := int(contentionRatio * totalObjects)
+
+				random := generateUniqueRandomNumbers(0, totalObjects, preCreatedObjects)
+				queriesCreatePartial := make([]ParamedCql, 0)
+				for _, i := range random {
+					params := getUserParams(i)
+					queriesCreatePartial = append(queriesCreatePartial, ParamedCql{
+						Query:  "CREATE (n:User{" + keyPattern("_id", "tenantId") + "}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+						Params: params,
+					})
+				}
+				queriesMerge := make([]ParamedCql, 0)
+				for i := 0; i < totalObjects; i++ {
+					params := getUserParams(i)
+					queriesMerge = append(queriesMerge, ParamedCql{
+						Query:  "MERGE (n:User{" + keyPattern("_id", "tenantId") + "}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+						Entity: "User",
+						Params: params,
+					})
+				}
+
+				return ExperimentConcurrentTenants(driver, queriesCreatePartial, queriesMerge, batchSize, contentionRatio)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func ExperimentConcurrentTenants(driver neo4j.DriverWithContext, queriesCreatePartial, queriesMerge []ParamedCql, batchSize int, contentionRatio float64) error {
+	// Experiment T1: Every tenant merges its own nodes concurrently in txn batches
+	// Partially populate the graph in batches
+	if err := executeBlindCreateInTxnBatches(driver, "txn batch create", queriesCreatePartial, batchSize, contentionRatio); err != nil {
+		return fmt.Errorf("failed to execute create queries: %w", err)
+	}
+	// Execute the merge queries of each tenant concurrently, timing each tenant separately
+	g := new(errgroup.Group)
+	st := time.Now()
+	for tenant, queries := range partitionByTenant(queriesMerge) {
+		g.Go(func() error {
+			return executeBlindCreateInTxnBatches(driver, withTenant("tenant txn batch merge", tenant), queries, batchSize, contentionRatio)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return fmt.Errorf("failed to execute merge queries: %w", err)
+	}
+	countWriteObjects := len(queriesMerge)
+	latency("tenant txn batch merge", batchSize, contentionRatio, st, nil, &countWriteObjects, nil, nil)
+	// Clear the graph
+	if err := resetGraph(driver); err != nil {
+		return fmt.Errorf("failed to clean up graph: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+var (
+	tenantCount     = 1
+	tenantSkew      = 0.0
+	tenantScopedIds = false
+)
+
+// tenantNames holds the tenants in order of decreasing size, tenantOfId maps every object id to its tenant and
+// tenantStartOfId to the first object id of its tenant
+var tenantNames []string
+var tenantOfId []string
+var tenantStartOfId []int
+
+// initTenants partitions the id space into tenantCount contiguous ranges whose sizes follow a zipf distribution
+// with exponent tenantSkew, so a skew of 0 yields equally sized tenants
+func initTenants() {
+	tenantNames = make([]string, 0)
+	tenantOfId = make([]string, totalObjects)
+	tenantStartOfId = make([]int, totalObjects)
+	if tenantCount <= 1 {
+		tenantNames = append(tenantNames, "tenant-X")
+		for i := range tenantOfId {
+			tenantOfId[i] = "tenant-X"
+		}
+		return
+	}
+
+	weights := make([]float64, tenantCount)
+	sum := 0.0
+	for k := range weights {
+		weights[k] = 1 / math.Pow(float64(k+1), tenantSkew)
+		sum += weights[k]
+	}
+	id, cumulative := 0, 0.0
+	for k := 0; k < tenantCount; k++ {
+		tenant := fmt.Sprintf("tenant-%d", k)
+		tenantNames = append(tenantNames, tenant)
+		cumulative += weights[k]
+		end := int(math.Round(cumulative / sum * totalObjects))
+		if k == tenantCount-1 {
+			end = totalObjects
+		}
+		for start := id; id < end; id++ {
+			tenantOfId[id], tenantStartOfId[id] = tenant, start
+		}
+	}
+}
+
+func tenantOf(id int) string {
+	return tenantOfId[id%totalObjects]
+}
+
+// idOf returns the number in the `~id` of the object: the object id when ids are unique globally, or the place of
+// the object in its tenant when they are only unique within a tenant. The object ids past totalObjects, which wrap
+// around to the tenants, keep their distance from the start of their tenant.
+func idOf(id int) int {
+	if !tenantScopedIds {
+		return id
+	}
+	return id - tenantStartOfId[id%totalObjects]
+}
+
+// tenantScoped reports whether the entity is addressed by its tenant along with its `~id`, which the nodes are when
+// ids are only unique within a tenant. The `~id` of a relationship carries the tenants of its endpoints instead.
+func tenantScoped(entity string) bool {
+	_, relationship := relationshipTypes[entity]
+	return tenantScopedIds && !relationship
+}
+
+// entityKey tells the entity of the parameters apart from the others: by its `~id`, qualified by its tenant when
+// tenant scoped
+func entityKey(entity string, params map[string]any) string {
+	if tenantScoped(entity) {
+		return params["tenantId"].(string) + "/" + params["_id"].(string)
+	}
+	return params["_id"].(string)
+}
+
+// entityKeyExpression is entityKey of the entity bound to n, in Cypher
+func entityKeyExpression(entity string) string {
+	if tenantScoped(entity) {
+		return "n.tenantId + '/' + n.`~id`"
+	}
+	return "n.`~id`"
+}
+
+// keyPattern returns the property map used to address a node by its `~id`, which also carries the tenant when
+// uniqueness is tenant-scoped so that the composite constraint can be used for the lookup
+func keyPattern(idParam, tenantParam string) string {
+	if tenantScopedIds {
+		return fmt.Sprintf("tenantId: $%s, `~id`: $%s", tenantParam, idParam)
+	}
+	return fmt.Sprintf("`~id`: $%s", idParam)
+}
+
+// withTenant labels a metric name with the tenant it was measured for
+func withTenant(name, tenant string) string {
+	return fmt.Sprintf("%s [%s]", name, tenant)
+}
+
+// partitionByTenant splits the queries by the tenantId parameter, preserving their order within each tenant
+func partitionByTenant(queries []ParamedCql) map[string][]ParamedCql {
+	partitions := make(map[string][]ParamedCql)
+	for _, query := range queries {
+		tenant, _ := query.Params["tenantId"].(string)
+		partitions[tenant] = append(partitions[tenant], query)
+	}
+	return partitions
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestTenantScopedIds(t *testing.T) {
+	defer func(count int, skew float64, scoped bool) {
+		tenantCount, tenantSkew, tenantScopedIds = count, skew, scoped
+		initTenants()
+	}(tenantCount, tenantSkew, tenantScopedIds)
+	tenantCount, tenantSkew, tenantScopedIds = 4, 1, true
+	initTenants()
+
+	keys := make(map[string]bool)
+	ids := make(map[string]int)
+	for i := 0; i < 2*totalObjects; i++ {
+		params := getUserParams(i)
+		key := entityKey("User", params)
+		if keys[key] {
+			t.Fatalf("object %d: key %s taken by another object", i, key)
+		}
+		keys[key] = true
+		ids[params["_id"].(string)]++
+	}
+	if ids["user-0"] != len(tenantNames) {
+		t.Errorf("user-0 in %d tenants, expected every one of the %d", ids["user-0"], len(tenantNames))
+	}
+}
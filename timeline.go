@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/montanaflynn/stats"
+)
+
+var (
+	timelinePath     = ""
+	timelineInterval = 100 * time.Millisecond
+)
+
+// validateTimelineInterval rejects intervals the ticker of a timeline cannot tick at
+func validateTimelineInterval() error {
+	if timelineInterval <= 0 {
+		return fmt.Errorf("timeline interval must be positive, got %s", timelineInterval)
+	}
+	return nil
+}
+
+// timelinePoint is the count of objects an executor had read and written after elapsed
+type timelinePoint struct {
+	elapsed time.Duration
+	objects int
+}
+
+// timelines holds the timeline of every measurement, alongside metrics and under the same lock
+var timelines = make(map[metricKey][][]timelinePoint)
+
+// timeline samples the cumulative objects of an executor every timelineInterval. The executors publish their counts
+// as every batch or query completes, and a ticker of the timeline reads them at fixed intervals, so that a point falls
+// on every interval however long the batches take.
+type timeline struct {
+	start   time.Time
+	objects atomic.Int64
+	points  []timelinePoint
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func startTimeline() *timeline {
+	t := &timeline{start: time.Now(), stop: make(chan struct{}), stopped: make(chan struct{})}
+	go func() {
+		defer close(t.stopped)
+		ticker := time.NewTicker(timelineInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.stop:
+				return
+			case now := <-ticker.C:
+				objects := int(t.objects.Load())
+				observeProgress(objects, now.Sub(t.start))
+				if timelinePath != "" {
+					t.points = append(t.points, timelinePoint{elapsed: now.Sub(t.start), objects: objects})
+				}
+			}
+		}
+	}()
+	return t
+}
+
+// observe publishes the objects the executor has read and written so far to the ticker
+func (t *timeline) observe(objects int) {
+	t.objects.Store(int64(objects))
+}
+
+// record stops the ticker and stores the timeline with the measurement of the executor, which latency records under
+// the same key
+func (t *timeline) record(name string, batchSize int, contentionRatio float64, objects int) {
+	close(t.stop)
+	<-t.stopped
+	if timelinePath == "" {
+		return
+	}
+	t.points = append(t.points, timelinePoint{elapsed: time.Since(t.start), objects: objects})
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	if discardMetrics {
+		return
+	}
+	key := metricKeyOf(name, batchSize, contentionRatio)
+	timelines[key] = append(timelines[key], t.points)
+}
+
+// writeTimelines stores every timeline as CSV, every point with the throughput over the interval leading up to it
+func writeTimelines() error {
+	file, err := os.Create(timelinePath)
+	if err != nil {
+		return fmt.Errorf("failed to create timeline file: %w", err)
+	}
+	defer file.Close()
+	if err := writeEnvironment(timelinePath); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"Name", "Batch Size", "Contention Ratio", "Txn Mode", "Schema", "Cache", "Run", "Elapsed", "Objects", "Interval Throughput"}); err != nil {
+		return fmt.Errorf("failed to write timelines: %w", err)
+	}
+	for key, runs := range timelines {
+		for run, points := range runs {
+			previous := timelinePoint{}
+			for _, point := range points {
+				throughput := 0.0
+				if interval := point.elapsed - previous.elapsed; interval > 0 {
+					throughput = float64(point.objects-previous.objects) / interval.Seconds()
+				}
+				if err := writer.Write([]string{
+					key.name,
+					fmt.Sprintf("%d", key.batchSize),
+					fmt.Sprintf("%.2f", key.contentionRatio),
+					key.txnMode,
+					key.schema,
+					key.cacheMode,
+					fmt.Sprintf("%d", run+1),
+					fmt.Sprintf("%d", point.elapsed.Milliseconds()),
+					fmt.Sprintf("%d", point.objects),
+					fmt.Sprintf("%.2f", throughput),
+				}); err != nil {
+					return fmt.Errorf("failed to write timelines: %w", err)
+				}
+				previous = point
+			}
+		}
+	}
+	return nil
+}
+
+// reportDegradationOverTime logs how much slower every measurement got between the first and the last quarter of its
+// time, as the graph and its indexes grew or concurrent updates kicked in
+func reportDegradationOverTime() {
+	for key, runs := range timelines {
+		ratios := make([]float64, 0)
+		for _, points := range runs {
+			if len(points) < 4 {
+				continue
+			}
+			total := points[len(points)-1]
+			first, last := points[len(points)/4], points[len(points)-1-len(points)/4]
+			firstThroughput := float64(first.objects) / first.elapsed.Seconds()
+			lastThroughput := float64(total.objects-last.objects) / (total.elapsed - last.elapsed).Seconds()
+			if firstThroughput > 0 {
+				ratios = append(ratios, lastThroughput/firstThroughput)
+			}
+		}
+		if len(ratios) == 0 {
+			continue
+		}
+		ratio, _ := stats.Median(ratios)
+		log.Printf("%s:\t batch size %d\t contention ratio %.2f\t txn mode %s\t schema %s\t cache %s\t last to first quarter throughput median %.2f\t",
+			key.name, key.batchSize, key.contentionRatio, key.txnMode, key.schema, key.cacheMode, ratio,
+		)
+	}
+}
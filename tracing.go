@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+var (
+	// traceEndpoint is the OTLP/HTTP endpoint of a collector the spans are exported to, such as http://localhost:4318
+	traceEndpoint = ""
+	// tracePath is a file the spans are exported to as OTLP JSON, one export request per line
+	tracePath = ""
+)
+
+// traceBatch is how many finished spans are exported at once
+const traceBatch = 1000
+
+// span is an operation of the sweep: an experiment family, a run of a strategy, one attempt at a transaction of the run,
+// or a query of the transaction
+type span struct {
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   [8]byte
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]any
+	err        error
+}
+
+var (
+	tracesMu sync.Mutex
+	// experimentSpan is the span of the experiment family being run
+	experimentSpan *span
+	finishedSpans  = make([]*span, 0, traceBatch)
+	traceFile      *os.File
+	exports        sync.WaitGroup
+	exportMu       sync.Mutex
+)
+
+func tracing() bool {
+	return traceEndpoint != "" || tracePath != ""
+}
+
+// startSpan opens a span under the parent, or in a trace of its own without one
+func startSpan(parent *span, name string, kind int, attributes map[string]any) *span {
+	s := &span{name: name, kind: kind, start: time.Now(), attributes: attributes}
+	if parent != nil {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else {
+		for i := range s.traceID {
+			s.traceID[i] = byte(rand.UintN(256))
+		}
+	}
+	for i := range s.spanID {
+		s.spanID[i] = byte(rand.UintN(256))
+	}
+	return s
+}
+
+// finish ends the span and exports it with the spans finished before it once a batch is complete
+func (s *span) finish(err error) {
+	s.end, s.err = time.Now(), err
+	tracesMu.Lock()
+	finishedSpans = append(finishedSpans, s)
+	if len(finishedSpans) < traceBatch {
+		tracesMu.Unlock()
+		return
+	}
+	batch := finishedSpans
+	finishedSpans = make([]*span, 0, traceBatch)
+	tracesMu.Unlock()
+	// Exported in the background so that no measurement waits on the collector
+	exports.Add(1)
+	go func() {
+		defer exports.Done()
+		exportSpans(batch)
+	}()
+}
+
+// startExperimentSpan opens the span the runs of an experiment family are traced under
+func startExperimentSpan(family string) {
+	if !tracing() {
+		return
+	}
+	s := startSpan(nil, family, 1, map[string]any{"glatency.family": family})
+	tracesMu.Lock()
+	defer tracesMu.Unlock()
+	experimentSpan = s
+}
+
+func finishExperimentSpan() {
+	tracesMu.Lock()
+	s := experimentSpan
+	experimentSpan = nil
+	tracesMu.Unlock()
+	if s != nil {
+		s.finish(nil)
+	}
+}
+
+// startRunSpan opens the span of a run of the strategy by an executor, under the span of the experiment family. There
+// is none unless the sweep is traced.
+func startRunSpan(name string) *span {
+	if !tracing() {
+		return nil
+	}
+	tracesMu.Lock()
+	defer tracesMu.Unlock()
+	return startSpan(experimentSpan, name, 1, map[string]any{"glatency.strategy": name})
+}
+
+// finishRunSpan ends the run of the strategy latency measured since start, with the counters of the measurement. A
+// measurement without a run of its own, spanning several executors, gets a span opened at its start.
+func finishRunSpan(run *span, name string, start time.Time, attributes map[string]any) {
+	if !tracing() {
+		return
+	}
+	if run == nil {
+		run = startRunSpan(name)
+	}
+	run.start = start
+	for k, v := range attributes {
+		run.attributes[k] = v
+	}
+	run.finish(nil)
+}
+
+// tracedWork traces every attempt at the transaction work of a run and the queries it runs
+func tracedWork(run *span, name string, work transactionWork) transactionWork {
+	if run == nil {
+		return work
+	}
+	attempt := 0
+	return func(tx transaction) (any, error) {
+		attempt++
+		metricsMu.Lock()
+		mode := txnMode
+		metricsMu.Unlock()
+		s := startSpan(run, "transaction", 1, map[string]any{"glatency.strategy": name, "glatency.attempt": attempt, "glatency.txn_mode": mode})
+		result, err := work(tracingTxn{transaction: tx, parent: s})
+		s.finish(err)
+		return result, err
+	}
+}
+
+// tracingTxn traces the queries of a transaction. The records are collected to count the rows and the summary
+// counters, which adds the buffering to the measured time of traced sweeps.
+type tracingTxn struct {
+	transaction
+	parent *span
+}
+
+func (tx tracingTxn) Run(ctx context.Context, cypher string, params map[string]any) (neo4j.ResultWithContext, error) {
+	attributes := map[string]any{"db.system": "neo4j", "db.statement": cypher}
+	// The executors batch their rows in a slice of a type of their own, []map[string]any for the most part
+	if rows := reflect.ValueOf(params["params"]); rows.Kind() == reflect.Slice {
+		attributes["glatency.params"] = rows.Len()
+	}
+	s := startSpan(tx.parent, "query", 3, attributes)
+	result, err := tx.transaction.Run(ctx, cypher, params)
+	if err != nil {
+		s.finish(err)
+		return nil, err
+	}
+	records, err := result.Collect(ctx)
+	if err != nil {
+		s.finish(err)
+		return nil, err
+	}
+	summary, err := result.Consume(ctx)
+	if err != nil {
+		s.finish(err)
+		return nil, err
+	}
+	// The writes return no records, so they are described by their counters and the reads by the rows they returned
+	if counters := summary.Counters(); counters.ContainsUpdates() {
+		attributes["glatency.nodes_created"] = counters.NodesCreated()
+		attributes["glatency.nodes_deleted"] = counters.NodesDeleted()
+		attributes["glatency.relationships_created"] = counters.RelationshipsCreated()
+		attributes["glatency.relationships_deleted"] = counters.RelationshipsDeleted()
+		attributes["glatency.properties_set"] = counters.PropertiesSet()
+		attributes["glatency.labels_added"] = counters.LabelsAdded()
+	} else {
+		attributes["glatency.rows"] = len(records)
+	}
+	s.finish(nil)
+	return &bufferedResult{ResultWithContext: result, records: records}, nil
+}
+
+// otlpValue encodes an attribute value as an OTLP AnyValue
+func otlpValue(value any) map[string]any {
+	switch v := value.(type) {
+	case int:
+		return map[string]any{"intValue": strconv.Itoa(v)}
+	case float64:
+		return map[string]any{"doubleValue": v}
+	case bool:
+		return map[string]any{"boolValue": v}
+	default:
+		return map[string]any{"stringValue": fmt.Sprint(v)}
+	}
+}
+
+// otlpRequest encodes the spans as an OTLP/JSON trace export request
+func otlpRequest(batch []*span) ([]byte, error) {
+	spans := make([]map[string]any, 0, len(batch))
+	for _, s := range batch {
+		attributes := make([]map[string]any, 0, len(s.attributes))
+		for k, v := range s.attributes {
+			attributes = append(attributes, map[string]any{"key": k, "value": otlpValue(v)})
+		}
+		encoded := map[string]any{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.spanID[:]),
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        attributes,
+			"status":            map[string]any{"code": 1},
+		}
+		if s.parentID != [8]byte{} {
+			encoded["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+		if s.err != nil {
+			encoded["status"] = map[string]any{"code": 2, "message": s.err.Error()}
+		}
+		spans = append(spans, encoded)
+	}
+	hostname, _ := os.Hostname()
+	resource := []map[string]any{
+		{"key": "service.name", "value": otlpValue("glatency")},
+		{"key": "host.name", "value": otlpValue(hostname)},
+	}
+	return json.Marshal(map[string]any{
+		"resourceSpans": []map[string]any{{
+			"resource":   map[string]any{"attributes": resource},
+			"scopeSpans": []map[string]any{{"scope": map[string]any{"name": "glatency"}, "spans": spans}},
+		}},
+	})
+}
+
+// exportSpans sends the spans to the collector and appends them to the trace file. A failed export is logged and the
+// spans are lost, so that an unavailable collector does not stop the sweep.
+func exportSpans(batch []*span) {
+	request, err := otlpRequest(batch)
+	if err != nil {
+		log.Printf("Failed to encode spans: %v", err)
+		return
+	}
+	exportMu.Lock()
+	defer exportMu.Unlock()
+	if tracePath != "" {
+		if traceFile == nil {
+			if traceFile, err = os.Create(tracePath); err != nil {
+				log.Printf("Failed to create trace file: %v", err)
+			}
+		}
+		if traceFile != nil {
+			if _, err := traceFile.Write(append(request, '\n')); err != nil {
+				log.Printf("Failed to write spans: %v", err)
+			}
+		}
+	}
+	if traceEndpoint != "" {
+		client := http.Client{Timeout: 10 * time.Second}
+		response, err := client.Post(strings.TrimSuffix(traceEndpoint, "/")+"/v1/traces", "application/json", bytes.NewReader(request))
+		if err != nil {
+			log.Printf("Failed to export spans: %v", err)
+			return
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			log.Printf("Failed to export spans: collector responded %s", response.Status)
+		}
+	}
+}
+
+// flushTraces exports the spans left once the sweep is done
+func flushTraces() error {
+	tracesMu.Lock()
+	batch := finishedSpans
+	finishedSpans = nil
+	tracesMu.Unlock()
+	if len(batch) > 0 {
+		exportSpans(batch)
+	}
+	exports.Wait()
+	if traceFile != nil {
+		return traceFile.Close()
+	}
+	return nil
+}
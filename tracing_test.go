@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// writeTxn answers every query as a write creating a node per row, the way the server answers a batch of the blind
+// create executors
+type writeTxn struct{}
+
+func (writeTxn) Run(_ context.Context, _ string, params map[string]any) (neo4j.ResultWithContext, error) {
+	return writeResult{created: len(params["params"].([]map[string]any))}, nil
+}
+
+type writeResult struct {
+	neo4j.ResultWithContext
+	created int
+}
+
+func (writeResult) Collect(context.Context) ([]*neo4j.Record, error) {
+	return nil, nil
+}
+
+func (r writeResult) Consume(context.Context) (neo4j.ResultSummary, error) {
+	return writeSummary{created: r.created}, nil
+}
+
+type writeSummary struct {
+	neo4j.ResultSummary
+	created int
+}
+
+func (s writeSummary) Counters() neo4j.Counters {
+	return writeCounters{created: s.created}
+}
+
+type writeCounters struct {
+	created int
+}
+
+func (c writeCounters) ContainsUpdates() bool       { return c.created > 0 }
+func (c writeCounters) NodesCreated() int           { return c.created }
+func (c writeCounters) NodesDeleted() int           { return 0 }
+func (c writeCounters) RelationshipsCreated() int   { return 0 }
+func (c writeCounters) RelationshipsDeleted() int   { return 0 }
+func (c writeCounters) PropertiesSet() int          { return 2 * c.created }
+func (c writeCounters) LabelsAdded() int            { return c.created }
+func (c writeCounters) LabelsRemoved() int          { return 0 }
+func (c writeCounters) IndexesAdded() int           { return 0 }
+func (c writeCounters) IndexesRemoved() int         { return 0 }
+func (c writeCounters) ConstraintsAdded() int       { return 0 }
+func (c writeCounters) ConstraintsRemoved() int     { return 0 }
+func (c writeCounters) SystemUpdates() int          { return 0 }
+func (c writeCounters) ContainsSystemUpdates() bool { return false }
+
+func TestTracingTxnAttributes(t *testing.T) {
+	defer func(spans []*span) { finishedSpans = spans }(finishedSpans)
+	finishedSpans = make([]*span, 0, traceBatch)
+
+	// A batch as the blind create executors push it
+	batch := make([]map[string]any, 0)
+	for _, id := range []string{"user-0", "user-1", "user-2"} {
+		batch = append(batch, map[string]any{"id": id, "name": id})
+	}
+	tx := tracingTxn{transaction: writeTxn{}, parent: startSpan(nil, "transaction", 1, map[string]any{})}
+	if _, err := tx.Run(context.Background(), "UNWIND $params AS param CREATE (:User {_id: param.id, name: param.name})", map[string]any{"params": batch}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(finishedSpans) != 1 {
+		t.Fatalf("got %d spans, expected the query", len(finishedSpans))
+	}
+	attributes := finishedSpans[0].attributes
+	for key, expected := range map[string]int{"glatency.params": 3, "glatency.nodes_created": 3, "glatency.properties_set": 6, "glatency.labels_added": 3} {
+		if got, ok := attributes[key].(int); !ok || got != expected {
+			t.Errorf("%s: got %v, expected %d", key, attributes[key], expected)
+		}
+	}
+	if _, ok := attributes["glatency.rows"]; ok {
+		t.Errorf("glatency.rows: got %v for a write", attributes["glatency.rows"])
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/montanaflynn/stats"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+var (
+	tuneStrategy        = "txn batch merge"
+	tuneContentionRatio = 0.5
+	tuneMinBatch        = 1
+	tuneMaxBatch        = 10000
+	tuneRuns            = 3
+	tuneEvaluations     = 12
+)
+
+// tunableStrategies are the node experiments the tune command can search the batch size of, keyed by the name the
+// experiment records its measurement of the strategy under
+var tunableStrategies = map[string]func(driver neo4j.DriverWithContext, queriesCreatePartial, queriesMerge, queriesCreate []ParamedCql, batchSize, preCreatedObjects int, contentionRatio float64){
+	"batch merge": func(driver neo4j.DriverWithContext, queriesCreatePartial, queriesMerge, queriesCreate []ParamedCql, batchSize, preCreatedObjects int, contentionRatio float64) {
+		ExperimentBatchedMerge(driver, queriesCreatePartial, queriesMerge, batchSize, contentionRatio)
+	},
+	"txn batch merge": func(driver neo4j.DriverWithContext, queriesCreatePartial, queriesMerge, queriesCreate []ParamedCql, batchSize, preCreatedObjects int, contentionRatio float64) {
+		ExperimentBatchedMatchInTxnBatches(driver, queriesCreatePartial, queriesCreate, queriesMerge, batchSize, contentionRatio, false)
+	},
+	"batch match>merge": func(driver neo4j.DriverWithContext, queriesCreatePartial, queriesMerge, queriesCreate []ParamedCql, batchSize, preCreatedObjects int, contentionRatio float64) {
+		ExperimentBatchedMatchAndBatchedMerge(driver, queriesCreatePartial, queriesMerge, batchSize, preCreatedObjects, contentionRatio)
+	},
+	"batch match+>merge": func(driver neo4j.DriverWithContext, queriesCreatePartial, queriesMerge, queriesCreate []ParamedCql, batchSize, preCreatedObjects int, contentionRatio float64) {
+		ExperimentBatchedMatchAndBatchedMergeWithUnwind(driver, queriesCreatePartial, queriesMerge, batchSize, preCreatedObjects, contentionRatio)
+	},
+	"batch match>create": func(driver neo4j.DriverWithContext, queriesCreatePartial, queriesMerge, queriesCreate []ParamedCql, batchSize, preCreatedObjects int, contentionRatio float64) {
+		ExperimentBatchedMatchAndBatchedCreate(driver, queriesCreatePartial, queriesCreate, batchSize, preCreatedObjects, contentionRatio)
+	},
+	"batch match+>create": func(driver neo4j.DriverWithContext, queriesCreatePartial, queriesMerge, queriesCreate []ParamedCql, batchSize, preCreatedObjects int, contentionRatio float64) {
+		ExperimentBatchedMatchAndBatchedCreateWithUnwind(driver, queriesCreatePartial, queriesCreate, batchSize, preCreatedObjects, contentionRatio)
+	},
+	"txn batch match>merge": func(driver neo4j.DriverWithContext, queriesCreatePartial, queriesMerge, queriesCreate []ParamedCql, batchSize, preCreatedObjects int, contentionRatio float64) {
+		ExperimentBatchedMatchAndBatchedMergeInTxnBatches(driver, queriesCreatePartial, queriesMerge, batchSize, contentionRatio, false)
+	},
+	"txn batch match+>merge": func(driver neo4j.DriverWithContext, queriesCreatePartial, queriesMerge, queriesCreate []ParamedCql, batchSize, preCreatedObjects int, contentionRatio float64) {
+		ExperimentBatchedMatchAndBatchedMergeWithUnwindInTxnBatches(driver, queriesCreatePartial, queriesMerge, batchSize, contentionRatio, false)
+	},
+	"txn batch match>create": func(driver neo4j.DriverWithContext, queriesCreatePartial, queriesMerge, queriesCreate []ParamedCql, batchSize, preCreatedObjects int, contentionRatio float64) {
+		ExperimentBatchedMatchAndBatchedCreateInTxnBatches(driver, queriesCreatePartial, queriesCreate, batchSize, contentionRatio, false)
+	},
+	"txn batch match+>create": func(driver neo4j.DriverWithContext, queriesCreatePartial, queriesMerge, queriesCreate []ParamedCql, batchSize, preCreatedObjects int, contentionRatio float64) {
+		ExperimentBatchedMatchAndBatchedCreateWithUnwindInTxnBatches(driver, queriesCreatePartial, queriesCreate, batchSize, contentionRatio, false)
+	},
+	"server batch merge": func(driver neo4j.DriverWithContext, queriesCreatePartial, queriesMerge, queriesCreate []ParamedCql, batchSize, preCreatedObjects int, contentionRatio float64) {
+		ExperimentBatchedMergeInTransactions(driver, queriesCreatePartial, queriesMerge, batchSize, contentionRatio)
+	},
+}
+
+func validateTuneStrategy(strategy string) error {
+	if _, ok := tunableStrategies[strategy]; !ok {
+		names := make([]string, 0, len(tunableStrategies))
+		for name := range tunableStrategies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown strategy '%s', expected one of: %s", strategy, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// validateTune rejects search bounds the golden-section search cannot narrow down on
+func validateTune() error {
+	if tuneMinBatch < 1 {
+		return fmt.Errorf("tune min batch must be at least 1, got %d", tuneMinBatch)
+	}
+	if tuneMinBatch >= tuneMaxBatch {
+		return fmt.Errorf("tune min batch %d must be below tune max batch %d", tuneMinBatch, tuneMaxBatch)
+	}
+	if tuneRuns < 1 {
+		return fmt.Errorf("tune runs must be at least 1, got %d", tuneRuns)
+	}
+	if tuneEvaluations < 2 {
+		return fmt.Errorf("tune evaluations must be at least 2, got %d", tuneEvaluations)
+	}
+	return nil
+}
+
+// RunTune searches the batch size maximising the throughput of the strategy at the contention ratio. Throughput is
+// taken to be unimodal in the logarithm of the batch size, which a golden-section search narrows down on until two
+// neighbouring batch sizes are left or the evaluations run out. Every evaluation runs the strategy tuneRuns times and
+// is scored by its median effective throughput, which makes up the curve returned.
+func RunTune(log *log.Logger, driver neo4j.DriverWithContext) map[int]float64 {
+	log.Printf("tuning the batch size of %s at contention ratio %.2f between %d and %d", tuneStrategy, tuneContentionRatio, tuneMinBatch, tuneMaxBatch)
+	experiment := tunableStrategies[tuneStrategy]
+	if tuneStrategy == "server batch merge" {
+		setTxnMode(txnModeAutoCommit)
+		defer setTxnMode(txnModeManaged)
+	}
+
+	curve := make(map[int]float64)
+	evaluate := func(x float64) float64 {
+		batchSize := int(math.Round(math.Exp(x)))
+		if throughput, ok := curve[batchSize]; ok {
+			return throughput
+		}
+		log.Printf("batch size: %d", batchSize)
+		for run := 0; run < tuneRuns; run++ {
+			queriesCreatePartial, queriesMerge, queriesCreate, preCreatedObjects := nodeQueries(tuneContentionRatio)
+			experiment(driver, queriesCreatePartial, queriesMerge, queriesCreate, batchSize, preCreatedObjects, tuneContentionRatio)
+		}
+		throughputs := make([]float64, 0)
+		metricsMu.Lock()
+		for key, ms := range metrics {
+			if key.name == tuneStrategy && key.batchSize == batchSize && key.contentionRatio == tuneContentionRatio {
+				for _, m := range ms {
+					throughputs = append(throughputs, m.effectiveThroughput)
+				}
+			}
+		}
+		metricsMu.Unlock()
+		curve[batchSize], _ = stats.Median(throughputs)
+		log.Printf("batch size %d:\t effective throughput median %.2f", batchSize, curve[batchSize])
+		return curve[batchSize]
+	}
+
+	phi := (math.Sqrt(5) - 1) / 2
+	lo, hi := math.Log(float64(tuneMinBatch)), math.Log(float64(tuneMaxBatch))
+	x1, x2 := hi-phi*(hi-lo), lo+phi*(hi-lo)
+	f1, f2 := evaluate(x1), evaluate(x2)
+	for len(curve) < tuneEvaluations && math.Round(math.Exp(x2))-math.Round(math.Exp(x1)) > 1 {
+		if f1 < f2 {
+			lo, x1, f1 = x1, x2, f2
+			x2 = lo + phi*(hi-lo)
+			f2 = evaluate(x2)
+		} else {
+			hi, x2, f2 = x2, x1, f1
+			x1 = hi - phi*(hi-lo)
+			f1 = evaluate(x1)
+		}
+	}
+
+	best := bestBatchSize(curve)
+	log.Print("explored curve:")
+	for _, batchSize := range sortedBatchSizes(curve) {
+		log.Printf("batch size %d:\t effective throughput median %.2f", batchSize, curve[batchSize])
+	}
+	log.Printf("recommended batch size for %s at contention ratio %.2f: %d (effective throughput median %.2f)", tuneStrategy, tuneContentionRatio, best, curve[best])
+	return curve
+}
+
+func sortedBatchSizes(curve map[int]float64) []int {
+	batchSizes := make([]int, 0, len(curve))
+	for batchSize := range curve {
+		batchSizes = append(batchSizes, batchSize)
+	}
+	sort.Ints(batchSizes)
+	return batchSizes
+}
+
+// bestBatchSize is the batch size of the highest throughput on the curve, the smallest of them on a tie
+func bestBatchSize(curve map[int]float64) int {
+	batchSizes := sortedBatchSizes(curve)
+	best := batchSizes[0]
+	for _, batchSize := range batchSizes {
+		if curve[batchSize] > curve[best] {
+			best = batchSize
+		}
+	}
+	return best
+}
+
+// writeTuneCurve stores the curve the tune command explored as CSV, in place of the measurements it is made of
+func writeTuneCurve(file *os.File, curve map[int]float64) error {
+	if err := writeEnvironment(file.Name()); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"Name", "Contention Ratio", "Batch Size", "Effective Throughput", "Recommended"}); err != nil {
+		return fmt.Errorf("failed to write tune curve: %w", err)
+	}
+	best := bestBatchSize(curve)
+	for _, batchSize := range sortedBatchSizes(curve) {
+		if err := writer.Write([]string{
+			tuneStrategy,
+			fmt.Sprintf("%.2f", tuneContentionRatio),
+			fmt.Sprintf("%d", batchSize),
+			fmt.Sprintf("%.2f", curve[batchSize]),
+			fmt.Sprintf("%t", batchSize == best),
+		}); err != nil {
+			return fmt.Errorf("failed to write tune curve: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+const (
+	txnModeManaged    = "managed"
+	txnModeExplicit   = "explicit"
+	txnModeAutoCommit = "auto-commit"
+)
+
+// allTxnModes are the transaction modes there are, and txnModes those the node experiments are run in
+var allTxnModes = []string{txnModeManaged, txnModeExplicit, txnModeAutoCommit}
+
+var txnModes = slices.Clone(allTxnModes)
+
+// txnMode is how the executors run their transaction work for the current cell. It is only changed between cells
+// through setTxnMode, under the metrics lock so that latency can label the measurements with it.
+var txnMode = txnModeManaged
+
+func setTxnMode(mode string) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	txnMode = mode
+}
+
+func validateTxnMode(mode string) error {
+	if !slices.Contains(allTxnModes, mode) {
+		return fmt.Errorf("unknown transaction mode '%s'", mode)
+	}
+	return nil
+}
+
+// transaction is what the transaction work runs its queries on, in every transaction mode. neo4j.ManagedTransaction
+// cannot be implemented outside the driver, so the work takes this instead and managed hands the driver's over.
+type transaction interface {
+	Run(ctx context.Context, cypher string, params map[string]any) (neo4j.ResultWithContext, error)
+}
+
+// transactionWork is the work of a strategy, run by executeWrite in the current transaction mode
+type transactionWork func(tx transaction) (any, error)
+
+// managed adapts transaction work for the driver to retry in a managed transaction
+func managed(work transactionWork) neo4j.ManagedTransactionWork {
+	return func(tx neo4j.ManagedTransaction) (any, error) {
+		return work(tx)
+	}
+}
+
+// autoCommitTxn hands the session itself to transaction work, so that every query the work runs is committed on its
+// own
+type autoCommitTxn struct {
+	session neo4j.SessionWithContext
+}
+
+func (tx autoCommitTxn) Run(ctx context.Context, cypher string, params map[string]any) (neo4j.ResultWithContext, error) {
+	result, err := tx.session.Run(ctx, cypher, params)
+	if err != nil {
+		return nil, err
+	}
+	// Collect the records right away, so that the query has completed and any error surfaces here rather than when
+	// the next query is run
+	records, err := result.Collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &bufferedResult{ResultWithContext: result, records: records}, nil
+}
+
+// bufferedResult replays the records collected from an auto-commit query
+type bufferedResult struct {
+	neo4j.ResultWithContext
+	records []*neo4j.Record
+	current *neo4j.Record
+}
+
+func (r *bufferedResult) Next(context.Context) bool {
+	if len(r.records) == 0 {
+		r.current = nil
+		return false
+	}
+	r.current, r.records = r.records[0], r.records[1:]
+	return true
+}
+
+func (r *bufferedResult) Record() *neo4j.Record {
+	return r.current
+}
+
+func (r *bufferedResult) Collect(context.Context) ([]*neo4j.Record, error) {
+	records := r.records
+	r.records = nil
+	return records, nil
+}
+
+// executeWrite runs the transaction work in the current transaction mode: retried by the driver when managed, in a
+// single transaction without retries when explicit, or query by query when auto-commit
+func executeWrite(session neo4j.SessionWithContext, work transactionWork) (any, error) {
+	switch txnMode {
+	case txnModeExplicit:
+		tx, err := session.BeginTransaction(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Close(context.Background())
+		result, err := work(tx)
+		if err != nil {
+			return nil, err
+		}
+		return result, tx.Commit(context.Background())
+	case txnModeAutoCommit:
+		return work(autoCommitTxn{session: session})
+	default:
+		return session.ExecuteWrite(context.Background(), managed(work))
+	}
+}
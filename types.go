@@ -1,6 +1,8 @@
 package main
 
-import "github.com/neo4j/neo4j-go-driver/v5/neo4j"
+import (
+	"time"
+)
 
 type ParamedCql struct {
 	Query  string
@@ -9,9 +11,30 @@ type ParamedCql struct {
 }
 
 type TxnWithMetadata struct {
-	Txn               neo4j.ManagedTransactionWork
+	Txn               transactionWork
 	CountReadObjects  int
 	CountWriteObjects int
 	CountReadQueries  int
 	CountWriteQueries int
 }
+
+// Operation is a single kind of query a workload issues, generated for one object id at a time. An operation with a
+// Concurrency is driven by that many workers of its own rather than mixed into the shared workers by its Weight.
+type Operation struct {
+	Name        string
+	Weight      float64
+	Concurrency int
+	Read        bool
+	Query       func(id int) ParamedCql
+}
+
+// Workload is a weighted mix of operations driven by Concurrency shared workers, alongside the workers of the
+// operations with a concurrency of their own, until Duration elapses or OperationCount operations have been issued,
+// whichever comes first. Every object of a batch counts as an operation.
+type Workload struct {
+	Name           string
+	Operations     []Operation
+	Concurrency    int
+	Duration       time.Duration
+	OperationCount int
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	workloadSpec        = ""
+	workloadConcurrency = 8
+	workloadDuration    = 10 * time.Second
+	workloadOperations  = 0
+)
+
+// operations are the building blocks of a workload, keyed by the name used in a workload spec
+var operations = map[string]Operation{
+	"create": {
+		Query: func(id int) ParamedCql {
+			return ParamedCql{
+				Query:  "MERGE (n:User{" + keyPattern("_id", "tenantId") + "}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+				Entity: "User",
+				Params: getUserParams(id),
+			}
+		},
+	},
+	"merge-edge": {
+		Query: func(id int) ParamedCql {
+			params := getEdgeParams(id, id%int(math.Sqrt(totalObjects)))
+			return ParamedCql{
+				Query:  "MERGE (u:User{" + keyPattern("user_id", "user_tenant") + "}) ON CREATE SET u += {tenantId: $user_tenant, isShellEntity: true, deletedAt: null} MERGE (g:Group{" + keyPattern("group_id", "group_tenant") + "}) ON CREATE SET g += {tenantId: $group_tenant, isShellEntity: true, deletedAt: null} MERGE (g)-[r:GROUP_USER_BINDING{`~id`: $_id}]->(u)",
+				Params: params,
+			}
+		},
+	},
+	"update": {
+		Query: func(id int) ParamedCql {
+			return ParamedCql{
+				Query:  "MATCH (n:User{" + keyPattern("_id", "tenantId") + "}) SET n += {name: $name + \"-Altered\", updatedAt: $updatedAt}",
+				Entity: "User",
+				Params: getUserParams(id),
+			}
+		},
+	},
+	"delete": {
+		Query: func(id int) ParamedCql {
+			return ParamedCql{
+				Query:  "MATCH (n:User{" + keyPattern("_id", "tenantId") + "}) DETACH DELETE n",
+				Entity: "User",
+				Params: getUserParams(id),
+			}
+		},
+	},
+	"read": {
+		Read: true,
+		Query: func(id int) ParamedCql {
+			return ParamedCql{
+				Query:  "MATCH (n:User{" + keyPattern("_id", "tenantId") + "}) RETURN n.`~id` AS entityId",
+				Entity: "User",
+				Params: getUserParams(id),
+			}
+		},
+	},
+}
+
+// workloadSpecs are the predefined mixes, modelled after the YCSB core workloads plus our own ingestion mix
+var workloadSpecs = map[string]string{
+	"a":      "read=50,update=50",
+	"b":      "read=95,update=5",
+	"c":      "read=100",
+	"ingest": "create=40,merge-edge=30,update=15,delete=5,read=10",
+}
+
+// parseWorkload builds a workload from a predefined name or from a spec of comma separated operation=weight pairs, a
+// pair optionally followed by :concurrency to drive the operation with workers of its own
+func parseWorkload(spec string) (Workload, error) {
+	name := spec
+	if predefined, ok := workloadSpecs[spec]; ok {
+		spec = predefined
+	}
+	workload := Workload{
+		Name:           "workload " + name,
+		Concurrency:    workloadConcurrency,
+		Duration:       workloadDuration,
+		OperationCount: workloadOperations,
+	}
+	shared, sharedWeight := 0, 0.0
+	for _, pair := range strings.Split(spec, ",") {
+		opName, weight, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return Workload{}, fmt.Errorf("invalid operation '%s': expected operation=weight[:concurrency]", pair)
+		}
+		op, ok := operations[opName]
+		if !ok {
+			return Workload{}, fmt.Errorf("unknown operation '%s'", opName)
+		}
+		weight, concurrency, dedicated := strings.Cut(weight, ":")
+		w, err := strconv.ParseFloat(weight, 64)
+		if err != nil || w < 0 {
+			return Workload{}, fmt.Errorf("invalid weight '%s' for operation '%s'", weight, opName)
+		}
+		if dedicated {
+			c, err := strconv.Atoi(concurrency)
+			if err != nil || c < 1 {
+				return Workload{}, fmt.Errorf("invalid concurrency '%s' for operation '%s'", concurrency, opName)
+			}
+			op.Concurrency = c
+		} else {
+			shared++
+			sharedWeight += w
+		}
+		op.Name = opName
+		op.Weight = w
+		workload.Operations = append(workload.Operations, op)
+	}
+	sort.Slice(workload.Operations, func(i, j int) bool { return workload.Operations[i].Name < workload.Operations[j].Name })
+	if shared > 0 && sharedWeight <= 0 {
+		return Workload{}, fmt.Errorf("the operations mixed by weight need a positive total weight")
+	}
+	if shared > 0 && workload.Concurrency < 1 {
+		return Workload{}, fmt.Errorf("the operations mixed by weight need at least one worker")
+	}
+	if workload.Duration <= 0 && workload.OperationCount <= 0 {
+		return Workload{}, fmt.Errorf("workload needs a duration or an operation count")
+	}
+	return workload, nil
+}
+
+func RunWorkloadExperiments(log *log.Logger, driver neo4j.DriverWithContext) error {
+	if workloadSpec == "" {
+		log.Print("skipping workload experiments: no workload")
+		return nil
+	}
+	workload, err := parseWorkload(workloadSpec)
+	if err != nil {
+		return fmt.Errorf("failed to parse workload: %w", err)
+	}
+	log.Print("running experiments")
+	for _, batchSize := range batches {
+		log.Printf("batch size: %d", batchSize)
+		for _, contentionRatio := range contentionRatios {
+			log.Printf("contention ratio: %.2f", contentionRatio)
+			err := forEachRun(log, driver, batchSize, contentionRatio, func() error {
+				// Create test sets
+
+				preCreatedObjects := int(contentionRatio * totalObjects)
+
+				random := generateUniqueRandomNumbers(0, totalObjects, preCreatedObjects)
+				queriesCreatePartial := make([]ParamedCql, 0)
+				for _, i := range random {
+					queriesCreatePartial = append(queriesCreatePartial, ParamedCql{
+						Query:  "CREATE (n:User{" + keyPattern("_id", "tenantId") + "}) SET n += {email: $email, id: $id, name: $name, tenantId: $tenantId, updatedAt: $updatedAt, isShellEntity: (coalesce(n.isShellEntity, true) AND false), deletedAt: null}",
+						Params: getUserParams(i),
+					})
+				}
+
+				// Partially populate the graph in batches
+				if err := executeBlindCreateInTxnBatches(driver, "txn batch create", queriesCreatePartial, batchSize, contentionRatio); err != nil {
+					return fmt.Errorf("failed to execute create queries: %w", err)
+				}
+				if err := RunWorkload(driver, workload, batchSize, contentionRatio); err != nil {
+					return fmt.Errorf("failed to run workload: %w", err)
+				}
+				// Clear the graph
+				if err := resetGraph(driver); err != nil {
+					return fmt.Errorf("failed to clean up graph: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RunWorkload drives the workload against the graph, recording every operation under "<workload>: <operation>" and the
+// workload as a whole under its own name
+func RunWorkload(driver neo4j.DriverWithContext, workload Workload, batchSize int, contentionRatio float64) error {
+	ctx := context.Background()
+	if workload.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, workload.Duration)
+		defer cancel()
+	}
+
+	var issued, countReadObjects, countWriteObjects atomic.Int64
+	// work issues operations picked from the pool with probability proportional to their weight
+	work := func(pool []Operation) error {
+		totalWeight := 0.0
+		for _, op := range pool {
+			totalWeight += op.Weight
+		}
+		for ctx.Err() == nil {
+			objects := min(batchSize, totalObjects)
+			if workload.OperationCount > 0 {
+				// The last batch is cut down to the operations left
+				before := issued.Add(int64(objects)) - int64(objects)
+				if before >= int64(workload.OperationCount) {
+					return nil
+				}
+				objects = min(objects, workload.OperationCount-int(before))
+			}
+			op := pool[len(pool)-1]
+			pick := rand.Float64() * totalWeight
+			for _, candidate := range pool {
+				if pick < candidate.Weight {
+					op = candidate
+					break
+				}
+				pick -= candidate.Weight
+			}
+			queries := make([]ParamedCql, 0)
+			for _, i := range generateUniqueRandomNumbers(0, totalObjects, objects) {
+				queries = append(queries, op.Query(i))
+			}
+			// The reads count the objects they found, which the ids of the objects not written yet miss
+			if op.Read {
+				found, err := executeReadInTxnBatches(driver, workload.Name+": "+op.Name, queries, batchSize, contentionRatio)
+				if err != nil {
+					return err
+				}
+				countReadObjects.Add(int64(found))
+				continue
+			}
+			if err := executeBlindCreateInTxnBatches(driver, workload.Name+": "+op.Name, queries, batchSize, contentionRatio); err != nil {
+				return err
+			}
+			countWriteObjects.Add(int64(len(queries)))
+		}
+		return nil
+	}
+
+	g := new(errgroup.Group)
+	st := time.Now()
+	shared := make([]Operation, 0)
+	for _, op := range workload.Operations {
+		if op.Concurrency == 0 {
+			shared = append(shared, op)
+			continue
+		}
+		for w := 0; w < op.Concurrency; w++ {
+			g.Go(func() error { return work([]Operation{op}) })
+		}
+	}
+	if len(shared) > 0 {
+		for w := 0; w < workload.Concurrency; w++ {
+			g.Go(func() error { return work(shared) })
+		}
+	}
+	err := g.Wait()
+	reads, writes := int(countReadObjects.Load()), int(countWriteObjects.Load())
+	latency(workload.Name, batchSize, contentionRatio, st, &reads, &writes, nil, nil)
+	return err
+}